@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Embedded admin UI for incident support: a single auth-gated page
+// listing live sessions with tracks, inbound level, and recent errors,
+// plus buttons to play a test tone or stop audio — so a support
+// engineer can poke a user's audio path without CLI access. Enabled by
+// BRIDGE_ADMIN_PORT; BRIDGE_ADMIN_TOKEN is mandatory, there is no
+// unauthenticated mode.
+const (
+	adminToneHz      = 440
+	adminToneSeconds = 1
+)
+
+type adminServer struct {
+	service *LiveKitBridgeService
+	token   string
+	srv     *http.Server
+}
+
+func newAdminServer(service *LiveKitBridgeService, port int, token string) *adminServer {
+	a := &adminServer{service: service, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", a.auth(a.handleIndex))
+	mux.HandleFunc("/api/sessions", a.auth(a.handleSessions))
+	mux.HandleFunc("/api/tone", a.auth(a.handleTone))
+	mux.HandleFunc("/api/stop", a.auth(a.handleStop))
+	a.srv = &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	return a
+}
+
+// Start serves the UI in the background until Stop.
+func (a *adminServer) Start() {
+	superviseLoop("admin ui", func() {
+		log.Printf("admin ui on %s", a.srv.Addr)
+		if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("admin ui: %v", err)
+		}
+	})
+}
+
+func (a *adminServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = a.srv.Shutdown(ctx)
+}
+
+// auth gates every route on the bearer token (also accepted as ?token=
+// for browser bookmarks). Constant-time compare; failures get a bare
+// 401 with no hint.
+func (a *adminServer) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if got == "" || got == r.Header.Get("Authorization") {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminSession is one row of the session table.
+type adminSession struct {
+	UserID           string   `json:"user_id"`
+	Tenant           string   `json:"tenant"`
+	Room             string   `json:"room"`
+	Connected        bool     `json:"connected"`
+	ParticipantCount int32    `json:"participant_count"`
+	Tracks           []string `json:"tracks"`
+	Level            int64    `json:"level"`
+	PlayingAppIDs    []string `json:"playing_app_ids"`
+	RecentErrors     []string `json:"recent_errors"`
+}
+
+func (a *adminServer) handleSessions(w http.ResponseWriter, r *http.Request) {
+	s := a.service
+	s.mu.Lock()
+	sessions := make([]*RoomSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	out := make([]adminSession, 0, len(sessions))
+	for _, session := range sessions {
+		_, count := session.ParticipantInfo()
+		row := adminSession{
+			UserID:           session.userID,
+			Tenant:           session.tenant,
+			Room:             session.roomName,
+			Connected:        session.Connected(),
+			ParticipantCount: int32(count),
+			Tracks:           session.trackList(),
+			Level:            session.audioLevel.Load(),
+			PlayingAppIDs:    session.playbackApps(),
+		}
+		for _, e := range session.recentErrorLog() {
+			row.RecentErrors = append(row.RecentErrors, e.Scope+": "+e.Message)
+		}
+		out = append(out, row)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (a *adminServer) handleTone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := r.URL.Query().Get("user")
+	session := a.service.getSession(userID)
+	if session == nil {
+		http.Error(w, "no session", http.StatusNotFound)
+		return
+	}
+	log.Printf("admin ui: playing test tone for user %s", userID)
+	if err := a.service.playTestTone(session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (a *adminServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := r.URL.Query().Get("user")
+	session := a.service.getSession(userID)
+	if session == nil {
+		http.Error(w, "no session", http.StatusNotFound)
+		return
+	}
+	stopped := session.stopPlayback()
+	log.Printf("admin ui: stopped playbacks %v for user %s", stopped, userID)
+	fmt.Fprintf(w, "stopped %d\n", len(stopped))
+}
+
+// playTestTone plays one second of 440Hz through the normal playback
+// path, so it exercises the DSP chain, track publish, and WriteSample
+// exactly like app audio does.
+func (s *LiveKitBridgeService) playTestTone(session *RoomSession) error {
+	req := &pb.PlayAudioRequest{
+		UserId:    session.userID,
+		RequestId: fmt.Sprintf("admin-tone-%d", time.Now().UnixMilli()),
+	}
+	ctx, cancel := context.WithCancel(session.ctx)
+	defer cancel()
+	if _, err := session.beginPlayback(req.TrackId, req.RequestId, "", cancel, s.config.MaxConcurrentPlaybacks, 0); err != nil {
+		return err
+	}
+	defer session.endPlayback(req.TrackId, req.RequestId)
+
+	pcm := make([]int16, adminToneSeconds*playbackSampleRate)
+	for i := range pcm {
+		pcm[i] = int16(8000 * math.Sin(2*math.Pi*adminToneHz*float64(i)/float64(playbackSampleRate)))
+	}
+	_, err := s.playFromPCM(ctx, session, req, pcm)
+	return err
+}
+
+func (a *adminServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, adminIndexHTML)
+}
+
+// adminIndexHTML is the whole UI: a table refreshed every two seconds.
+// Deliberately framework-free so it keeps working from an embedded
+// binary with no asset pipeline.
+const adminIndexHTML = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>livekit-bridge admin</title>
+<style>
+body { font: 13px monospace; margin: 1.5em; background: #111; color: #ddd; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #444; padding: 4px 8px; text-align: left; }
+th { background: #222; }
+.err { color: #f66; }
+button { font: inherit; }
+</style>
+</head>
+<body>
+<h2>livekit-bridge sessions</h2>
+<table id="t"><thead><tr>
+<th>user</th><th>tenant</th><th>room</th><th>conn</th><th>parts</th>
+<th>tracks</th><th>level</th><th>playing</th><th>errors</th><th></th>
+</tr></thead><tbody></tbody></table>
+<script>
+const token = new URLSearchParams(location.search).get("token") || "";
+async function api(path, opts) {
+  const r = await fetch(path + (path.includes("?") ? "&" : "?") + "token=" + encodeURIComponent(token), opts);
+  if (!r.ok) throw new Error(await r.text());
+  return r;
+}
+async function refresh() {
+  try {
+    const rows = await (await api("/api/sessions")).json();
+    const tb = document.querySelector("#t tbody");
+    tb.innerHTML = "";
+    for (const s of rows) {
+      const tr = document.createElement("tr");
+      const errs = (s.recent_errors || []).slice(-3).join("<br>");
+      tr.innerHTML =
+        "<td>" + s.user_id + "</td><td>" + s.tenant + "</td><td>" + (s.room || "") +
+        "</td><td>" + (s.connected ? "yes" : "no") + "</td><td>" + s.participant_count +
+        "</td><td>" + (s.tracks || []).join(", ") + "</td><td>" + s.level +
+        "</td><td>" + (s.playing_app_ids || []).join(", ") +
+        "</td><td class=err>" + errs + "</td>" +
+        "<td><button onclick=\"tone('" + s.user_id + "')\">tone</button> " +
+        "<button onclick=\"stop('" + s.user_id + "')\">stop</button></td>";
+      tb.appendChild(tr);
+    }
+  } catch (e) { console.error(e); }
+}
+async function tone(u) { await api("/api/tone?user=" + encodeURIComponent(u), {method: "POST"}); }
+async function stop(u) { await api("/api/stop?user=" + encodeURIComponent(u), {method: "POST"}); }
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
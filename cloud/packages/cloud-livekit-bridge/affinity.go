@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Session affinity for load-balanced deployments. JoinRoom hands the
+// client an opaque token naming the instance that owns the session; the
+// client echoes it in request metadata, and the interceptors reject
+// requests an L4 balancer delivered to the wrong instance with a
+// redirect hint instead of silently creating a split-brain session.
+const (
+	// Request metadata key the client echoes the token under
+	affinityMetadataKey = "x-bridge-affinity"
+
+	// Response metadata key carrying the owning instance on rejection
+	affinityOwnerKey = "x-bridge-owner"
+)
+
+// makeAffinityToken encodes the owning instance for a user session.
+// Opaque to clients; the format is bridge-internal and may change.
+func makeAffinityToken(instanceID, userID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("v1|" + instanceID + "|" + userID))
+}
+
+// parseAffinityToken reverses makeAffinityToken.
+func parseAffinityToken(token string) (instanceID, userID string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", fmt.Errorf("bad affinity token: %w", err)
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || parts[0] != "v1" {
+		return "", "", fmt.Errorf("bad affinity token")
+	}
+	return parts[1], parts[2], nil
+}
+
+// checkAffinity validates a token from request metadata, if present.
+// Requests without a token pass: JoinRoom establishes affinity, and
+// admin RPCs are instance-agnostic.
+func (s *LiveKitBridgeService) checkAffinity(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	tokens := md.Get(affinityMetadataKey)
+	if len(tokens) == 0 {
+		return nil
+	}
+	instanceID, userID, err := parseAffinityToken(tokens[0])
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if instanceID == s.config.InstanceID {
+		return nil
+	}
+	// Redirect hint in the response metadata so the caller can re-dial
+	// the owning instance directly.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(affinityOwnerKey, instanceID))
+	return status.Errorf(codes.FailedPrecondition,
+		"session for user %s is owned by instance %s (this is %s)", userID, instanceID, s.config.InstanceID)
+}
+
+// affinityUnaryInterceptor enforces checkAffinity on unary RPCs.
+func (s *LiveKitBridgeService) affinityUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.checkAffinity(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// affinityStreamInterceptor enforces checkAffinity on streaming RPCs.
+func (s *LiveKitBridgeService) affinityStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.checkAffinity(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
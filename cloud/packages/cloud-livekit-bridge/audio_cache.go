@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// audioCache holds decoded PCM keyed by audio URL, shared across
+// sessions, so a broadcast clip sent to hundreds of users is fetched
+// and decoded once. Entries are pre-gain (volume is applied per play),
+// expire after a TTL, and the cache LRU-evicts to stay under its byte
+// budget. Entries that came with an ETag survive expiry: the fetch path
+// revalidates them with If-None-Match, and a 304 reuses the decoded PCM
+// without re-downloading.
+type audioCache struct {
+	mu         sync.Mutex
+	entries    map[string]*audioCacheEntry
+	totalBytes int64
+	maxBytes   int64
+	ttl        time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type audioCacheEntry struct {
+	pcm      []int16
+	etag     string
+	addedAt  time.Time
+	lastUsed time.Time
+}
+
+func newAudioCache(maxBytes int64, ttl time.Duration) *audioCache {
+	return &audioCache{
+		entries:  make(map[string]*audioCacheEntry),
+		maxBytes: maxBytes,
+		ttl:      ttl,
+	}
+}
+
+// get returns the cached PCM for url, or nil on miss/expiry.
+func (c *audioCache) get(url string) []int16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok {
+		c.misses.Add(1)
+		return nil
+	}
+	if time.Since(entry.addedAt) > c.ttl {
+		// Entries with an ETag stay for revalidation (staleETag /
+		// refresh); without one there is nothing to validate against.
+		if entry.etag == "" {
+			c.totalBytes -= int64(len(entry.pcm)) * 2
+			delete(c.entries, url)
+		}
+		c.misses.Add(1)
+		return nil
+	}
+	entry.lastUsed = time.Now()
+	c.hits.Add(1)
+	return entry.pcm
+}
+
+// staleETag returns the ETag of an expired entry for url, so the fetch
+// can revalidate with If-None-Match instead of re-downloading. Empty
+// when there is no expired entry or it carries no validator.
+func (c *audioCache) staleETag(url string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok || time.Since(entry.addedAt) <= c.ttl {
+		return ""
+	}
+	return entry.etag
+}
+
+// refresh marks an entry fresh again after a 304 Not Modified and
+// returns its PCM (nil if the entry was evicted in the meantime).
+func (c *audioCache) refresh(url string) []int16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	entry.addedAt = now
+	entry.lastUsed = now
+	c.hits.Add(1)
+	return entry.pcm
+}
+
+// put stores decoded PCM for url, evicting least-recently-used entries
+// until it fits. Clips bigger than the whole budget are not cached.
+func (c *audioCache) put(url, etag string, pcm []int16) {
+	size := int64(len(pcm)) * 2
+	if size == 0 || size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[url]; ok {
+		c.totalBytes -= int64(len(old.pcm)) * 2
+		delete(c.entries, url)
+	}
+	for c.totalBytes+size > c.maxBytes {
+		var oldestURL string
+		var oldest time.Time
+		for u, entry := range c.entries {
+			if oldestURL == "" || entry.lastUsed.Before(oldest) {
+				oldestURL = u
+				oldest = entry.lastUsed
+			}
+		}
+		if oldestURL == "" {
+			break
+		}
+		c.totalBytes -= int64(len(c.entries[oldestURL].pcm)) * 2
+		delete(c.entries, oldestURL)
+	}
+	now := time.Now()
+	c.entries[url] = &audioCacheEntry{pcm: pcm, etag: etag, addedAt: now, lastUsed: now}
+	c.totalBytes += size
+}
+
+// stats reports hit/miss counters and current size for HealthCheck.
+func (c *audioCache) stats() (hits, misses, bytes int64) {
+	c.mu.Lock()
+	bytes = c.totalBytes
+	c.mu.Unlock()
+	return c.hits.Load(), c.misses.Load(), bytes
+}
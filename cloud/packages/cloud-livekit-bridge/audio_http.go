@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a failed address is deprioritized before being retried.
+const audioDialBadFor = 30 * time.Second
+
+// Per-address dial budget while there are more addresses to fall back to;
+// the final address gets whatever remains of the request context.
+const audioDialAttemptTimeout = 2 * time.Second
+
+// newAudioHTTPClient builds the shared client for PlayAudio fetches.
+// TTS hosts are hit repeatedly, so it keeps idle connections and (when a
+// DNS TTL is configured) dials through a caching resolver with per-host
+// address health instead of re-resolving on every request.
+func newAudioHTTPClient(config *Config) *http.Client {
+	client := &http.Client{Timeout: config.AudioFetchTimeout}
+	if config.AudioDNSCacheTTL <= 0 {
+		return client
+	}
+	d := &audioDialer{
+		hosts: make(map[string]*audioHostEntry),
+		ttl:   config.AudioDNSCacheTTL,
+	}
+	client.Transport = &http.Transport{
+		DialContext:         d.dial,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return client
+}
+
+// allowedFetchHeaders is the set of caller-suppliable fetch headers
+// (canonical names). Everything else is rejected at validation: these
+// headers reach third-party origins verbatim, so a caller must not be
+// able to smuggle Host, Range, or cache directives.
+var allowedFetchHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+	"Api-Key":       true,
+	"X-Auth-Token":  true,
+	"User-Agent":    true,
+}
+
+// allowedFetchHeaderList names the allowed headers for error messages.
+var allowedFetchHeaderList = func() string {
+	names := make([]string, 0, len(allowedFetchHeaders))
+	for name := range allowedFetchHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}()
+
+// audioFetchHeaders builds the extra header set for a playback fetch
+// and its follow-up requests (prefetch segments, resumes): the
+// configured User-Agent, overridden by the caller's allow-listed
+// headers. Applied with setFetchHeaders wherever the fetch's requests
+// are built, so a protected origin sees the same credentials on every
+// request of the download.
+func (s *LiveKitBridgeService) audioFetchHeaders(custom map[string]string) http.Header {
+	h := http.Header{}
+	if s.config.AudioUserAgent != "" {
+		h.Set("User-Agent", s.config.AudioUserAgent)
+	}
+	for k, v := range custom {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// setFetchHeaders applies the extra fetch headers to a request.
+func setFetchHeaders(req *http.Request, hdr http.Header) {
+	for k, vs := range hdr {
+		req.Header[k] = vs
+	}
+}
+
+// doAudioFetch issues an audio fetch, retrying transient failures —
+// transport errors (timeouts, connection resets) and 5xx replies — with
+// exponential backoff before the playback reports FAILED. 4xx replies
+// are not retried: the origin answered, the request is just wrong. The
+// request must be bodyless so re-issuing it is safe.
+func (s *LiveKitBridgeService) doAudioFetch(req *http.Request) (*http.Response, error) {
+	backoff := s.config.AudioFetchBackoff
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		resp, err := s.audioHTTP.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err != nil {
+			lastErr = err
+		} else {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		if attempt >= s.config.AudioFetchRetries || req.Context().Err() != nil {
+			return nil, lastErr
+		}
+		log.Printf("audio fetch %s failed (%v), retry %d/%d in %v",
+			req.URL, lastErr, attempt+1, s.config.AudioFetchRetries, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, lastErr
+		}
+		backoff *= 2
+	}
+}
+
+// prewarmAudioOrigins opens connections to the configured TTS/CDN
+// origins so the first spoken response after a deploy doesn't pay DNS,
+// TCP, and TLS setup. When an interval is set it keeps re-touching the
+// origins so the HTTP/2 connections never idle out of the pool.
+func prewarmAudioOrigins(client *http.Client, origins []string, interval time.Duration) {
+	warm := func() {
+		for _, origin := range origins {
+			go func(origin string) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodHead, origin, nil)
+				if err != nil {
+					log.Printf("audio prewarm: bad origin %s: %v", origin, err)
+					return
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					log.Printf("audio prewarm %s: %v", origin, err)
+					return
+				}
+				resp.Body.Close()
+			}(origin)
+		}
+	}
+
+	log.Printf("prewarming %d audio origins", len(origins))
+	warm()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			warm()
+		}
+	}()
+}
+
+// audioDialer resolves audio hosts through a TTL cache and dials the
+// cached addresses in health order: the address that last worked first,
+// then IPv4 before IPv6 (a stale AAAA record is the usual 100-300ms
+// penalty here), with recently-failed addresses pushed to the back
+// rather than dropped so a host can recover.
+type audioDialer struct {
+	dialer net.Dialer
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*audioHostEntry
+}
+
+type audioHostEntry struct {
+	addrs      []net.IP
+	resolvedAt time.Time
+	lastGood   string
+	bad        map[string]time.Time
+}
+
+func (d *audioDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	// IP literals need no resolution or fallback.
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for i, ip := range d.ordered(host, addrs) {
+		attemptCtx := ctx
+		if i < len(addrs)-1 {
+			var cancel context.CancelFunc
+			attemptCtx, cancel = context.WithTimeout(ctx, audioDialAttemptTimeout)
+			defer cancel()
+		}
+		conn, err := d.dialer.DialContext(attemptCtx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			d.markGood(host, ip.String())
+			return conn, nil
+		}
+		lastErr = err
+		d.markBad(host, ip.String())
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, lastErr
+}
+
+// resolve returns cached addresses for host, re-resolving after the TTL.
+// A failed refresh falls back to the stale entry rather than failing the
+// fetch outright.
+func (d *audioDialer) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	d.mu.Lock()
+	// Snapshot the stale addresses under the lock: a concurrent refresh
+	// rewrites entry.addrs, so reading it after unlock would race.
+	var stale []net.IP
+	if entry := d.hosts[host]; entry != nil {
+		if time.Since(entry.resolvedAt) < d.ttl {
+			addrs := entry.addrs
+			d.mu.Unlock()
+			return addrs, nil
+		}
+		stale = entry.addrs
+	}
+	d.mu.Unlock()
+
+	ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		if stale != nil {
+			return stale, nil
+		}
+		return nil, err
+	}
+	addrs := make([]net.IP, 0, len(ipAddrs))
+	for _, a := range ipAddrs {
+		addrs = append(addrs, a.IP)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if existing := d.hosts[host]; existing != nil {
+		existing.addrs = addrs
+		existing.resolvedAt = time.Now()
+	} else {
+		d.hosts[host] = &audioHostEntry{
+			addrs:      addrs,
+			resolvedAt: time.Now(),
+			bad:        make(map[string]time.Time),
+		}
+	}
+	return addrs, nil
+}
+
+// ordered sorts addresses for dialing: last-known-good first, healthy v4
+// before healthy v6, recently-failed addresses last.
+func (d *audioDialer) ordered(host string, addrs []net.IP) []net.IP {
+	d.mu.Lock()
+	entry := d.hosts[host]
+	lastGood := ""
+	badUntil := make(map[string]time.Time, len(addrs))
+	if entry != nil {
+		lastGood = entry.lastGood
+		for ip, at := range entry.bad {
+			badUntil[ip] = at.Add(audioDialBadFor)
+		}
+	}
+	d.mu.Unlock()
+
+	now := time.Now()
+	var front, v4, v6, back []net.IP
+	for _, ip := range addrs {
+		key := ip.String()
+		switch {
+		case key == lastGood:
+			front = append(front, ip)
+		case now.Before(badUntil[key]):
+			back = append(back, ip)
+		case ip.To4() != nil:
+			v4 = append(v4, ip)
+		default:
+			v6 = append(v6, ip)
+		}
+	}
+	out := append(front, v4...)
+	out = append(out, v6...)
+	return append(out, back...)
+}
+
+func (d *audioDialer) markGood(host, ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry := d.hosts[host]; entry != nil {
+		entry.lastGood = ip
+		delete(entry.bad, ip)
+	}
+}
+
+func (d *audioDialer) markBad(host, ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry := d.hosts[host]; entry != nil {
+		if entry.lastGood == ip {
+			entry.lastGood = ""
+		}
+		entry.bad[ip] = time.Now()
+	}
+}
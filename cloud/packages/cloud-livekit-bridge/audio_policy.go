@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Denial codes returned in the FAILED event's metadata when a PlayAudio
+// request is blocked by policy, so apps can tell "blocked" from "broken".
+const (
+	policyDenyQuietHours = "POLICY_QUIET_HOURS"
+	policyDenyAppCap     = "POLICY_APP_CAP"
+)
+
+// audioPolicyEngine evaluates per-user playback policy before audio
+// starts: quiet hours, per-app daily duration caps, and a max-volume
+// ceiling. Policies are pushed by the cloud via SetAudioPolicy and held
+// in memory only; the cloud re-pushes them on JoinRoom, so a bridge
+// restart just means a brief policy-free window.
+type audioPolicyEngine struct {
+	mu       sync.Mutex
+	policies map[string]*pb.AudioPolicy
+
+	// Per-app playback milliseconds for the current UTC day
+	usage    map[string]map[string]int64
+	usageDay string
+}
+
+func newAudioPolicyEngine() *audioPolicyEngine {
+	return &audioPolicyEngine{
+		policies: make(map[string]*pb.AudioPolicy),
+		usage:    make(map[string]map[string]int64),
+	}
+}
+
+func (e *audioPolicyEngine) set(userID string, policy *pb.AudioPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if policy == nil {
+		delete(e.policies, userID)
+		return
+	}
+	e.policies[userID] = policy
+}
+
+// deny returns the denial code for a playback attempt, or "" when the
+// request may proceed. System audio (empty appID) is never capped but
+// still honors quiet hours.
+func (e *audioPolicyEngine) deny(userID, appID string, now time.Time) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	policy := e.policies[userID]
+	if policy == nil {
+		return ""
+	}
+	if policy.QuietHoursEnabled && inQuietHours(policy, now) {
+		return policyDenyQuietHours
+	}
+	if appID != "" {
+		if capSec, ok := policy.AppDailyCapSeconds[appID]; ok && capSec > 0 {
+			if e.usageLocked(userID, now)[appID] >= capSec*1000 {
+				return policyDenyAppCap
+			}
+		}
+	}
+	return ""
+}
+
+// clampVolume applies the user's max-volume ceiling to a requested
+// volume (after the default is resolved).
+func (e *audioPolicyEngine) clampVolume(userID string, volume float32) float32 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	policy := e.policies[userID]
+	if policy == nil || policy.MaxVolume <= 0 {
+		return volume
+	}
+	if volume > policy.MaxVolume {
+		return policy.MaxVolume
+	}
+	return volume
+}
+
+// recordUsage charges played audio against the app's daily cap.
+func (e *audioPolicyEngine) recordUsage(userID, appID string, playedMs int64) {
+	if appID == "" || playedMs <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.usageLocked(userID, time.Now())[appID] += playedMs
+}
+
+// usageLocked returns the user's usage map for the current UTC day,
+// resetting all counters when the day rolls over. Caller holds mu.
+func (e *audioPolicyEngine) usageLocked(userID string, now time.Time) map[string]int64 {
+	day := now.UTC().Format("2006-01-02")
+	if day != e.usageDay {
+		e.usage = make(map[string]map[string]int64)
+		e.usageDay = day
+	}
+	m := e.usage[userID]
+	if m == nil {
+		m = make(map[string]int64)
+		e.usage[userID] = m
+	}
+	return m
+}
+
+// inQuietHours reports whether now falls in the policy's quiet window,
+// evaluated in the user's local time via the policy's UTC offset. The
+// window may wrap midnight (e.g. 22:00 → 07:00).
+func inQuietHours(policy *pb.AudioPolicy, now time.Time) bool {
+	return inQuietWindow(policy.QuietStartMinutes, policy.QuietEndMinutes, policy.UtcOffsetMinutes, now)
+}
+
+// inQuietWindow reports whether now falls in a minutes-from-midnight
+// window, evaluated in local time via the UTC offset. Shared between
+// policy quiet hours and preference do-not-disturb.
+func inQuietWindow(start, end, utcOffset int32, now time.Time) bool {
+	if start == end {
+		return false
+	}
+	local := now.UTC().Add(time.Duration(utcOffset) * time.Minute)
+	minutes := int32(local.Hour()*60 + local.Minute())
+	if start < end {
+		return minutes >= start && minutes < end
+	}
+	return minutes >= start || minutes < end
+}
+
+// SetAudioPolicy installs (or clears) the playback policy for a user.
+func (s *LiveKitBridgeService) SetAudioPolicy(ctx context.Context, req *pb.SetAudioPolicyRequest) (*pb.SetAudioPolicyResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if req.Policy != nil {
+		p := req.Policy
+		if p.QuietStartMinutes < 0 || p.QuietStartMinutes >= 24*60 ||
+			p.QuietEndMinutes < 0 || p.QuietEndMinutes >= 24*60 {
+			return nil, status.Errorf(codes.InvalidArgument, "quiet hours out of range")
+		}
+	}
+	s.policy.set(req.UserId, req.Policy)
+	if req.Policy == nil {
+		log.Printf("audio policy cleared for user %s", req.UserId)
+	} else {
+		log.Printf("audio policy set for user %s (quiet_hours=%v, app_caps=%d, max_volume=%.2f)",
+			req.UserId, req.Policy.QuietHoursEnabled, len(req.Policy.AppDailyCapSeconds), req.Policy.MaxVolume)
+	}
+	return &pb.SetAudioPolicyResponse{Success: true}, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// How many times a broken download is resumed (resumeReader) or a failed
+// prefetch segment re-fetched before the playback gives up.
+const resumeMaxRetries = 3
+
+// prefetchReader reads a Range-capable HTTP source in fixed segments,
+// fetching the next segment while the caller decodes the current one.
+// The one-segment channel buffer is the read-ahead: a CDN throughput dip
+// shorter than one segment's playtime never reaches the decoder.
+type prefetchReader struct {
+	segments chan prefetchSegment
+	cancel   context.CancelFunc
+	cur      []byte
+	hdr      http.Header // extra headers for every segment request
+}
+
+type prefetchSegment struct {
+	data []byte
+	err  error
+}
+
+// newPrefetchReader streams url from offset start up to size (exclusive)
+// in segmentSize chunks, sending hdr on every segment request. Close
+// releases the fetch goroutine.
+func newPrefetchReader(ctx context.Context, client *http.Client, url string, start, size, segmentSize int64, hdr http.Header) *prefetchReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &prefetchReader{
+		segments: make(chan prefetchSegment, 1),
+		cancel:   cancel,
+		hdr:      hdr,
+	}
+	go r.fetchLoop(ctx, client, url, start, size, segmentSize)
+	return r
+}
+
+func (r *prefetchReader) fetchLoop(ctx context.Context, client *http.Client, url string, start, size, segmentSize int64) {
+	defer close(r.segments)
+	for off := start; off < size; off += segmentSize {
+		end := off + segmentSize
+		if end > size {
+			end = size
+		}
+		data, err := fetchRange(ctx, client, url, off, end-1, r.hdr)
+		// Flaky egress drops segments mid-file; re-fetching the failed
+		// segment is cheap next to failing the whole playback.
+		for attempt := 1; err != nil && ctx.Err() == nil && attempt <= resumeMaxRetries; attempt++ {
+			log.Printf("audio prefetch: segment %d-%d of %s failed (%v), retry %d/%d",
+				off, end-1, url, err, attempt, resumeMaxRetries)
+			data, err = fetchRange(ctx, client, url, off, end-1, r.hdr)
+		}
+		select {
+		case r.segments <- prefetchSegment{data: data, err: err}:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func fetchRange(ctx context.Context, client *http.Client, url string, first, last int64, hdr http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setFetchHeaders(req, hdr)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("range fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range fetch: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("range fetch: %w", err)
+	}
+	return data, nil
+}
+
+func (r *prefetchReader) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		seg, ok := <-r.segments
+		if !ok {
+			return 0, io.EOF
+		}
+		if seg.err != nil {
+			return 0, seg.err
+		}
+		r.cur = seg.data
+	}
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+func (r *prefetchReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// resumeReader wraps a one-shot download body and, when the connection
+// drops mid-file, re-issues the GET with Range from the last byte
+// received instead of surfacing the error. If-Range pins the resume to
+// the same entity when the origin sent an ETag; a server that ignores
+// Range replies 200 and the stream is realigned by discarding the bytes
+// already delivered.
+type resumeReader struct {
+	ctx     context.Context
+	client  *http.Client
+	url     string
+	etag    string
+	body    io.ReadCloser
+	offset  int64
+	retries int
+	hdr     http.Header // extra headers for resume requests
+}
+
+func newResumeReader(ctx context.Context, client *http.Client, url, etag string, body io.ReadCloser, hdr http.Header) *resumeReader {
+	return &resumeReader{ctx: ctx, client: client, url: url, etag: etag, body: body, hdr: hdr}
+}
+
+func (r *resumeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF || r.ctx.Err() != nil || r.retries >= resumeMaxRetries {
+			return n, err
+		}
+		r.retries++
+		log.Printf("audio fetch: %s broke at byte %d (%v), resuming %d/%d",
+			r.url, r.offset, err, r.retries, resumeMaxRetries)
+		if rerr := r.resume(); rerr != nil {
+			return n, fmt.Errorf("resume audio fetch: %w", rerr)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *resumeReader) resume() error {
+	r.body.Close()
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	setFetchHeaders(req, r.hdr)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	if r.etag != "" {
+		req.Header.Set("If-Range", r.etag)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// No Range support (or If-Range says the file changed under
+		// us); skip what was already played to stay aligned.
+		if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumeReader) Close() error {
+	return r.body.Close()
+}
+
+// parseContentRangeTotal extracts the total size from a Content-Range
+// header ("bytes 0-262143/5242880"), or -1 if it is absent or unsized.
+func parseContentRangeTotal(header string) int64 {
+	i := strings.LastIndex(header, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// drcProfile shapes playback output for a listening environment. The
+// compressor is a static per-sample waveshaper: no attack/release
+// envelope, which is fine for the TTS speech this path carries and
+// keeps it cheap enough to run on every playback sample.
+type drcProfile struct {
+	name string
+
+	// Linear full-scale fractions: samples above threshold are
+	// compressed by ratio, everything is scaled by makeup gain, and the
+	// result is capped at ceiling.
+	threshold float64
+	ratio     float64
+	makeup    float64
+	ceiling   float64
+}
+
+// whisperProfile is the "quiet environment" shape: heavy compression
+// and a low ceiling so late-night TTS stays intelligible at very low
+// glasses volume without peaks jumping out.
+var whisperProfile = &drcProfile{
+	name:      "whisper",
+	threshold: 0.05,
+	ratio:     4,
+	makeup:    2.5,
+	ceiling:   0.25,
+}
+
+// profileByName maps an RPC profile name to its shape (nil = default
+// passthrough).
+func profileByName(name string) (*drcProfile, error) {
+	switch name {
+	case "", "default":
+		return nil, nil
+	case "whisper":
+		return whisperProfile, nil
+	default:
+		return nil, fmt.Errorf("unknown audio profile %q (supported: default, whisper)", name)
+	}
+}
+
+// apply shapes samples in place.
+func (p *drcProfile) apply(samples []int16) {
+	for i, s := range samples {
+		v := float64(s) / 32768
+		a := math.Abs(v)
+		if a > p.threshold {
+			a = p.threshold + (a-p.threshold)/p.ratio
+		}
+		a *= p.makeup
+		if a > p.ceiling {
+			a = p.ceiling
+		}
+		if v < 0 {
+			a = -a
+		}
+		samples[i] = int16(a * 32767)
+	}
+}
+
+// SetAudioProfile switches the session's output shaping profile. The
+// profile applies to everything written to the session's tracks
+// (PlayAudio and streamed TTS alike) until changed again.
+func (s *LiveKitBridgeService) SetAudioProfile(ctx context.Context, req *pb.SetAudioProfileRequest) (*pb.SetAudioProfileResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	profile, err := profileByName(req.Profile)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.SetAudioProfileResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	session.outputProfile.Store(profile)
+	name := "default"
+	if profile != nil {
+		name = profile.name
+	}
+	session.note("audio_profile", name)
+	log.Printf("audio profile for user %s: %s", req.UserId, name)
+	return &pb.SetAudioProfileResponse{Success: true}, nil
+}
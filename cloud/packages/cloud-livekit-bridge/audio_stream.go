@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// StreamAudio is the bidirectional audio data plane.
+//
+// Client → bridge chunks are written to the published LiveKit track for the
+// chunk's track_id. Bridge → client carries inbound room audio (DataChannel
+// packets, UDP uplink). Backpressure is handled by HTTP/2 flow control:
+// stream.Send blocks when the client can't keep up, no manual buffering.
+func (s *LiveKitBridgeService) StreamAudio(stream pb.LiveKitBridge_StreamAudioServer) error {
+	// User ID comes from the first chunk.
+	firstChunk, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "no initial chunk: %v", err)
+	}
+	userID := firstChunk.UserId
+	if userID == "" {
+		return status.Errorf(codes.InvalidArgument, "first chunk must carry user_id")
+	}
+	session := s.getSession(userID)
+	if session == nil {
+		return status.Errorf(codes.FailedPrecondition, "no session for user %s (call JoinRoom first)", userID)
+	}
+	if err := s.checkTenant(stream.Context(), session); err != nil {
+		return err
+	}
+
+	// Archiving/relaying consumers can ask for encoded frames instead of
+	// raw PCM; the codec is fixed for the life of the stream.
+	outChannels := 1
+	if session.stereoMix != nil {
+		outChannels = 2
+	}
+	encoder, err := newStreamEncoder(firstChunk.OutputCodec, 16000, outChannels)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if encoder != nil {
+		log.Printf("StreamAudio for user %s delivering %s", userID, encoder.name())
+	}
+
+	s.activeStreams.Add(1)
+	defer s.activeStreams.Add(-1)
+	log.Printf("StreamAudio attached for user %s", userID)
+
+	// Surface the session's transcription hints once as stream headers so
+	// the ASR-forwarding consumer doesn't need a per-utterance lookup.
+	if len(session.transcriptionHints) > 0 {
+		md := metadata.MD{}
+		for k, v := range session.transcriptionHints {
+			md.Append("asr-hint-"+strings.ToLower(k), v)
+		}
+		if err := stream.SetHeader(md); err != nil {
+			log.Printf("StreamAudio: set hint headers for user %s: %v", userID, err)
+		}
+	}
+
+	errChan := make(chan error, 2)
+
+	// Receive from client → LiveKit track.
+	go func() {
+		if len(firstChunk.PcmData) > 0 {
+			if err := s.writeChunkToTrack(session, firstChunk); err != nil {
+				errChan <- err
+				return
+			}
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				errChan <- nil
+				return
+			}
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if err := s.writeChunkToTrack(session, chunk); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	}()
+
+	// Send from LiveKit → client. Heartbeat chunks (no PCM) let the cloud
+	// distinguish a silent user from a broken audio path.
+	go func() {
+		var heartbeatC <-chan time.Time
+		if s.config.StreamHeartbeatInterval > 0 {
+			ticker := time.NewTicker(s.config.StreamHeartbeatInterval)
+			defer ticker.Stop()
+			heartbeatC = ticker.C
+		}
+		var sentSinceHB int64
+		lastDropped := atomic.LoadInt64(&session.framesDropped)
+		for {
+			select {
+			case frame, ok := <-session.audioFromLiveKit:
+				if !ok {
+					errChan <- nil
+					return
+				}
+				channels := int32(1)
+				if frame.channels > 1 {
+					channels = int32(frame.channels)
+				}
+				data, codec := frame.pcm, ""
+				if encoder != nil {
+					encoded, err := encoder.encode(frame.pcm)
+					if err != nil {
+						errChan <- err
+						return
+					}
+					if len(encoded) == 0 {
+						continue
+					}
+					data, codec = encoded, encoder.name()
+				}
+				if err := stream.Send(&pb.AudioChunk{
+					PcmData:        data,
+					SampleRate:     16000,
+					Channels:       channels,
+					TimestampMs:    time.Now().UnixMilli(),
+					UserId:         userID,
+					SenderIdentity: frame.senderIdentity,
+					TrackName:      frame.trackName,
+					OutputCodec:    codec,
+				}); err != nil {
+					errChan <- err
+					return
+				}
+				sentSinceHB++
+			case <-heartbeatC:
+				dropped := atomic.LoadInt64(&session.framesDropped)
+				if err := stream.Send(&pb.AudioChunk{
+					TimestampMs:     time.Now().UnixMilli(),
+					UserId:          userID,
+					Heartbeat:       true,
+					FramesForwarded: sentSinceHB,
+					FramesDropped:   dropped - lastDropped,
+				}); err != nil {
+					errChan <- err
+					return
+				}
+				sentSinceHB = 0
+				lastDropped = dropped
+			case <-session.ctx.Done():
+				errChan <- nil
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			log.Printf("StreamAudio error for user %s: %v", userID, err)
+			session.recordError("stream", "%v", err)
+		}
+		return err
+	case <-session.ctx.Done():
+		return nil
+	case <-stream.Context().Done():
+		return nil
+	}
+}
+
+// writeChunkToTrack decodes an AudioChunk into int16 samples and writes it
+// to the published track for the chunk's track_id.
+func (s *LiveKitBridgeService) writeChunkToTrack(session *RoomSession, chunk *pb.AudioChunk) error {
+	if len(chunk.PcmData) == 0 {
+		return nil
+	}
+	track, tf, err := session.getOrCreateTrack(chunk.TrackId, trackFormat{})
+	if err != nil {
+		return err
+	}
+	samples := bytesToInt16(chunk.PcmData)
+	atomic.AddInt64(&session.samplesPlayed, int64(len(samples)))
+	if p := session.outputProfile.Load(); p != nil {
+		p.apply(samples)
+	}
+	session.mirrorToRTP(chunk.TrackId, samples)
+	// Chunk PCM is mono at the playback rate; convert when the track
+	// was published in another format by a PlayAudio request.
+	if tf.channels == 2 {
+		samples = monoToStereo(samples)
+	}
+	if tf.rate != playbackSampleRate {
+		samples = resampleInterleaved(samples, tf.channels, playbackSampleRate, tf.rate)
+	}
+	return track.WriteSample(samples)
+}
+
+// bytesToInt16 converts little-endian PCM16 bytes to samples.
+// Odd trailing bytes are dropped.
+func bytesToInt16(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2 : i*2+2]))
+	}
+	return samples
+}
+
+// int16ToBytes converts samples back to little-endian PCM16 bytes.
+func int16ToBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:i*2+2], uint16(v))
+	}
+	return data
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Audit log: every state-changing RPC is recorded with caller address,
+// redacted parameters, and outcome — in a fixed-size in-memory ring for
+// QueryAuditLog, and optionally appended as JSONL to a file for
+// compliance retention. Tokens and keys never reach either sink.
+
+// auditedMethods is the set of RPCs that change state. Read-only RPCs
+// (health, status, listings) are deliberately not recorded.
+var auditedMethods = map[string]bool{
+	"JoinRoom":               true,
+	"LeaveRoom":              true,
+	"PlayAudio":              true,
+	"StopAudio":              true,
+	"StopAudioBatch":         true,
+	"EmergencyBroadcast":     true,
+	"SetTrackVolume":         true,
+	"PauseAudio":             true,
+	"ResumeAudio":            true,
+	"EnqueueAudio":           true,
+	"ClearQueue":             true,
+	"SetAudioProfile":        true,
+	"SetAudioPolicy":         true,
+	"SetUserPreferences":     true,
+	"SetRtpMirror":           true,
+	"RegisterUdpUser":        true,
+	"RegisterUdpUserBatch":   true,
+	"UnregisterUdpUser":      true,
+	"UnregisterUdpUserBatch": true,
+	"StartUdpCapture":        true,
+	"StopUdpCapture":         true,
+	"RebindUdp":              true,
+	"ExportSession":          true,
+	"ImportSession":          true,
+}
+
+type auditLog struct {
+	mu      sync.Mutex
+	entries []*pb.AuditEntry // ring, entries[next] is the oldest
+	next    int
+	full    bool
+	file    *os.File
+}
+
+func newAuditLog(config *Config) *auditLog {
+	a := &auditLog{entries: make([]*pb.AuditEntry, config.AuditBuffer)}
+	if config.AuditFile != "" {
+		f, err := os.OpenFile(config.AuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Printf("audit file %s: %v (memory-only audit)", config.AuditFile, err)
+		} else {
+			a.file = f
+		}
+	}
+	return a
+}
+
+func (a *auditLog) record(entry *pb.AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) > 0 {
+		a.entries[a.next] = entry
+		a.next = (a.next + 1) % len(a.entries)
+		if a.next == 0 {
+			a.full = true
+		}
+	}
+	if a.file != nil {
+		line, err := json.Marshal(map[string]interface{}{
+			"ts_ms":   entry.TimestampMs,
+			"method":  entry.Method,
+			"caller":  entry.Caller,
+			"user_id": entry.UserId,
+			"params":  entry.Params,
+			"outcome": entry.Outcome,
+		})
+		if err == nil {
+			a.file.Write(append(line, '\n'))
+		}
+	}
+}
+
+// query returns matching entries, newest first.
+func (a *auditLog) query(userID, method string, limit int) []*pb.AuditEntry {
+	if limit <= 0 {
+		limit = 100
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.next
+	if a.full {
+		n = len(a.entries)
+	}
+	var out []*pb.AuditEntry
+	for i := 0; i < n && len(out) < limit; i++ {
+		// Walk backwards from the newest slot.
+		idx := (a.next - 1 - i + len(a.entries)) % len(a.entries)
+		e := a.entries[idx]
+		if e == nil {
+			break
+		}
+		if userID != "" && e.UserId != userID {
+			continue
+		}
+		if method != "" && e.Method != method {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// auditRecord builds and stores one entry for a finished RPC.
+func (s *LiveKitBridgeService) auditRecord(ctx context.Context, method string, req interface{}, err error) {
+	caller := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		caller = p.Addr.String()
+	}
+	userID, params := auditParams(req)
+	outcome := "ok"
+	if err != nil {
+		outcome = err.Error()
+	}
+	s.audit.record(&pb.AuditEntry{
+		TimestampMs: time.Now().UnixMilli(),
+		Method:      method,
+		Caller:      caller,
+		UserId:      userID,
+		Params:      params,
+		Outcome:     outcome,
+	})
+}
+
+// auditParams extracts the caller-visible identity and parameters for
+// a request, leaving out anything secret (LiveKit tokens, encryption
+// keys, export blobs).
+func auditParams(req interface{}) (string, map[string]string) {
+	switch r := req.(type) {
+	case *pb.JoinRoomRequest:
+		return r.UserId, map[string]string{"room": r.RoomName, "livekit_url": r.LivekitUrl}
+	case *pb.LeaveRoomRequest:
+		return r.UserId, nil
+	case *pb.PlayAudioRequest:
+		params := map[string]string{"request_id": r.RequestId, "url": r.AudioUrl}
+		if r.AppId != "" {
+			params["app_id"] = r.AppId
+		}
+		return r.UserId, params
+	case *pb.StopAudioRequest:
+		params := map[string]string{}
+		if r.RequestId != "" {
+			params["request_id"] = r.RequestId
+		}
+		return r.UserId, params
+	case *pb.StopAudioBatchRequest:
+		params := map[string]string{"users": strconv.Itoa(len(r.UserIds))}
+		if r.Reason != "" {
+			params["reason"] = r.Reason
+		}
+		return "", params
+	case *pb.EmergencyBroadcastRequest:
+		params := map[string]string{
+			"request_id": r.RequestId,
+			"url":        r.AudioUrl,
+			"users":      strconv.Itoa(len(r.UserIds)),
+		}
+		if r.Reason != "" {
+			params["reason"] = r.Reason
+		}
+		return "", params
+	case *pb.SetTrackVolumeRequest:
+		return r.UserId, map[string]string{
+			"track":  strconv.Itoa(int(r.TrackId)),
+			"volume": strconv.FormatFloat(float64(r.Volume), 'f', 2, 32),
+		}
+	case *pb.SetAudioProfileRequest:
+		return r.UserId, map[string]string{"profile": r.Profile}
+	case *pb.SetAudioPolicyRequest:
+		return r.UserId, nil
+	case *pb.SetUserPreferencesRequest:
+		return r.UserId, nil
+	case *pb.SetRtpMirrorRequest:
+		return r.UserId, map[string]string{"address": r.Address, "codec": r.Codec}
+	case *pb.RegisterUdpUserRequest:
+		return r.UserId, nil
+	case *pb.UnregisterUdpUserRequest:
+		// Hash-only messages: record the hash, there is no user ID to log.
+		return "", map[string]string{"hash": strconv.FormatUint(uint64(r.UserIdHash), 10)}
+	case *pb.StartUdpCaptureRequest:
+		return "", map[string]string{"hash": strconv.FormatUint(uint64(r.UserIdHash), 10)}
+	case *pb.StopUdpCaptureRequest:
+		return "", nil
+	case *pb.ExportSessionRequest:
+		return r.UserId, nil
+	case *pb.ImportSessionRequest:
+		return "", nil // blob is opaque and stays out of the log
+	default:
+		return "", nil
+	}
+}
+
+// shortMethod strips "/livekit.LiveKitBridge/" from a full method name.
+func shortMethod(fullMethod string) string {
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[i+1:]
+	}
+	return fullMethod
+}
+
+// auditUnaryInterceptor records state-changing unary RPCs.
+func (s *LiveKitBridgeService) auditUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if method := shortMethod(info.FullMethod); auditedMethods[method] {
+		s.auditRecord(ctx, method, req, err)
+	}
+	return resp, err
+}
+
+// auditStreamInterceptor records state-changing streaming RPCs
+// (PlayAudio). The request arrives via RecvMsg, so the stream is
+// wrapped to capture the first message.
+func (s *LiveKitBridgeService) auditStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method := shortMethod(info.FullMethod)
+	if !auditedMethods[method] {
+		return handler(srv, ss)
+	}
+	wrapped := &auditServerStream{ServerStream: ss}
+	err := handler(srv, wrapped)
+	s.auditRecord(ss.Context(), method, wrapped.req, err)
+	return err
+}
+
+type auditServerStream struct {
+	grpc.ServerStream
+	req interface{}
+}
+
+func (s *auditServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = m
+	}
+	return err
+}
+
+// QueryAuditLog returns recorded state-changing RPCs, newest first,
+// optionally filtered by user and method.
+func (s *LiveKitBridgeService) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be >= 0")
+	}
+	return &pb.QueryAuditLogResponse{
+		Entries: s.audit.query(req.UserId, req.Method, int(req.Limit)),
+	}, nil
+}
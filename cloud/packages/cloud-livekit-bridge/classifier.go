@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// soundEventCooldown is the per-label refractory period; a ringing alarm
+// should produce one event per burst, not one per frame.
+const soundEventCooldown = 5 * time.Second
+
+// soundClassifier labels inbound 16kHz mono PCM with detected sound
+// events ("alarm", "siren", "doorbell", ...) for accessibility apps.
+// Like wakeDetector, implementations keep their own state and are fed
+// one frame at a time.
+type soundClassifier interface {
+	name() string
+	// feed consumes one PCM16LE frame and returns the labels detected
+	// in it (usually empty).
+	feed(pcm []byte) []string
+}
+
+// soundClassifierFactories is the pluggable model registry; real
+// classifiers register here from their own files. "tonal" is the
+// built-in reference implementation.
+var soundClassifierFactories = map[string]func() soundClassifier{
+	"tonal": newTonalClassifier,
+}
+
+func newSoundClassifier(name string) (soundClassifier, error) {
+	factory, ok := soundClassifierFactories[name]
+	if !ok {
+		names := make([]string, 0, len(soundClassifierFactories))
+		for n := range soundClassifierFactories {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown sound classifier %q (available: %v)", name, names)
+	}
+	return factory(), nil
+}
+
+// sessionClassifier serializes feeds (UDP and LiveKit goroutines can
+// interleave across a transport switch) and applies a per-label
+// cooldown before events reach subscribers.
+type sessionClassifier struct {
+	mu     sync.Mutex
+	cls    soundClassifier
+	lastAt map[string]time.Time
+}
+
+func newSessionClassifier(cls soundClassifier) *sessionClassifier {
+	return &sessionClassifier{cls: cls, lastAt: make(map[string]time.Time)}
+}
+
+// observe feeds one frame and returns the labels that should fire events.
+func (c *sessionClassifier) observe(pcm []byte, now time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var fire []string
+	for _, label := range c.cls.feed(pcm) {
+		if now.Sub(c.lastAt[label]) < soundEventCooldown {
+			continue
+		}
+		c.lastAt[label] = now
+		fire = append(fire, label)
+	}
+	return fire
+}
+
+// tonalClassifier is the reference implementation: it flags sustained
+// loud tones in the alarm band (roughly 800-3200Hz) as "alarm", using
+// zero-crossing rate as a cheap pitch estimate. Real models will do
+// better; this one is deliberately simple and keeps the hook honest
+// about per-frame budgets.
+type tonalClassifier struct {
+	hot int // consecutive tonal high-energy frames
+}
+
+func newTonalClassifier() soundClassifier {
+	return &tonalClassifier{}
+}
+
+func (c *tonalClassifier) name() string { return "tonal" }
+
+func (c *tonalClassifier) feed(pcm []byte) []string {
+	samples := bytesToInt16(pcm)
+	if len(samples) < 32 {
+		return nil
+	}
+	var sum float64
+	crossings := 0
+	for i, s := range samples {
+		sum += float64(s) * float64(s)
+		if i > 0 && (s >= 0) != (samples[i-1] >= 0) {
+			crossings++
+		}
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	// Dominant frequency approximation: two crossings per cycle.
+	freq := float64(crossings) / 2 / (float64(len(samples)) / float64(playbackSampleRate))
+
+	if rms > 2000 && freq >= 800 && freq <= 3200 {
+		c.hot++
+	} else {
+		c.hot = 0
+	}
+	// ~0.3-1s of sustained tone depending on frame cadence.
+	if c.hot == 10 {
+		return []string{"alarm"}
+	}
+	return nil
+}
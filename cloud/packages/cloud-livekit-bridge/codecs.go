@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Decoder registry: playAudioFile routes a fetched body to the first
+// decoder claiming its content type or URL extension, so a new codec
+// (Opus, AAC, FLAC) is one registry entry and its own file instead of
+// another arm on a growing switch. Raw PCM (request-declared, not
+// content-sniffed) and live RTSP/RTP stay structural in playback.go.
+
+// decodeFunc streams a fetched body through the playback pipeline.
+// collect, when non-nil, receives the decoded pre-gain 16kHz mono
+// stream for the shared cache.
+type decodeFunc func(s *LiveKitBridgeService, ctx context.Context, session *RoomSession, r io.Reader, req *pb.PlayAudioRequest, collect func([]int16), ab *resamplerAB) (int64, error)
+
+// audioDecoder is one registry entry. Entries without a description
+// are reject-only: the codec is recognized but not built into this
+// binary, and play returns a typed unsupportedFormatError naming it.
+type audioDecoder struct {
+	name         string
+	description  string // as quoted in supportedPlaybackFormats
+	contentTypes []string
+	extensions   []string
+	play         decodeFunc
+}
+
+// matches reports whether the decoder claims the content type or, as a
+// fallback, the URL extension.
+func (d *audioDecoder) matches(contentType, urlPath string) bool {
+	for _, ct := range d.contentTypes {
+		if contentType == ct {
+			return true
+		}
+	}
+	for _, ext := range d.extensions {
+		if strings.HasSuffix(urlPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// audioDecoders is checked in order; the first match wins, so a
+// decoder's extension claim can shadow a later decoder's content type.
+var audioDecoders = []*audioDecoder{
+	{
+		name:         "mp3",
+		description:  "audio/mpeg (mp3)",
+		contentTypes: []string{"audio/mpeg", "audio/mp3"},
+		extensions:   []string{".mp3"},
+		play:         (*LiveKitBridgeService).playMP3,
+	},
+	{
+		name:         "wav",
+		description:  "audio/wav (16-bit PCM)",
+		contentTypes: []string{"audio/wav", "audio/x-wav", "audio/wave"},
+		extensions:   []string{".wav"},
+		play:         (*LiveKitBridgeService).playWAV,
+	},
+	{
+		name:        "hls",
+		description: "application/vnd.apple.mpegurl (HLS, mp3/wav segments)",
+		contentTypes: []string{
+			"application/vnd.apple.mpegurl", "application/x-mpegurl",
+			"audio/x-mpegurl", "audio/mpegurl",
+		},
+		extensions: []string{".m3u8"},
+		play:       (*LiveKitBridgeService).playHLSBody,
+	},
+	{
+		name:         "ogg",
+		contentTypes: []string{"audio/ogg", "audio/opus"},
+		extensions:   []string{".ogg", ".opus"},
+		play: func(_ *LiveKitBridgeService, _ context.Context, _ *RoomSession, r io.Reader, _ *pb.PlayAudioRequest, _ func([]int16), _ *resamplerAB) (int64, error) {
+			return 0, rejectOgg(r)
+		},
+	},
+	{
+		name:         "aac",
+		contentTypes: []string{"audio/aac", "audio/aacp", "audio/mp4", "audio/x-m4a"},
+		extensions:   []string{".aac", ".m4a", ".mp4"},
+		play: func(_ *LiveKitBridgeService, _ context.Context, _ *RoomSession, r io.Reader, _ *pb.PlayAudioRequest, _ func([]int16), _ *resamplerAB) (int64, error) {
+			return 0, rejectAAC(r)
+		},
+	},
+}
+
+// decoderFor returns the registry entry for a response, or nil when no
+// decoder claims it.
+func decoderFor(contentType, urlPath string) *audioDecoder {
+	for _, d := range audioDecoders {
+		if d.matches(contentType, urlPath) {
+			return d
+		}
+	}
+	return nil
+}
+
+// supportedPlaybackFormats is what the playback dispatch can actually
+// decode, quoted in unsupported-format errors and reported via
+// GetInstanceInfo so app developers know what to transcode to. Built
+// from the registry plus the structural paths that bypass it.
+var supportedPlaybackFormats = func() []string {
+	var out []string
+	for _, d := range audioDecoders {
+		if d.description != "" {
+			out = append(out, d.description)
+		}
+	}
+	return append(out,
+		"raw 16-bit PCM via sample_rate",
+		"rtsp/rtp (raw PCM live)",
+	)
+}()
+
+// unsupportedFormatError is a structured format rejection: the error
+// (and the FAILED event metadata) carries the supported list, so a
+// developer staring at "application/octet-stream" knows what to
+// transcode to.
+type unsupportedFormatError struct {
+	contentType string
+	detail      string // decoder-specific explanation, if any
+}
+
+func (e *unsupportedFormatError) Error() string {
+	msg := "unsupported audio format: " + e.contentType
+	if e.detail != "" {
+		msg = e.detail
+	}
+	return msg + " (supported: " + strings.Join(supportedPlaybackFormats, "; ") + ")"
+}
+
+// playHLSBody adapts playHLS to the registry signature: the playlist is
+// read up front and segment fetching follows from there, so the body
+// collector never applies.
+func (s *LiveKitBridgeService) playHLSBody(ctx context.Context, session *RoomSession, r io.Reader, req *pb.PlayAudioRequest, _ func([]int16), ab *resamplerAB) (int64, error) {
+	playlist, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("read playlist: %w", err)
+	}
+	if req.StartOffsetMs > 0 {
+		return 0, fmt.Errorf("seek is not supported for HLS sources")
+	}
+	return s.playHLS(ctx, session, req, playlist, ab)
+}
+
+// rejectOgg names the codec inside an Ogg stream in the error instead
+// of the generic "unsupported audio format". There is no Opus decoder
+// in this binary: the build is pure Go (no cgo/libopus, see Dockerfile)
+// and no tagged pure-Go decoder exists to depend on, so Opus TTS output
+// still needs transcoding upstream. The first Ogg page starts with the
+// codec's magic right after the 27-byte header and segment table.
+func rejectOgg(r io.Reader) error {
+	head := make([]byte, 64)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	codec := "unknown codec"
+	switch {
+	case bytes.Contains(head, []byte("OpusHead")):
+		codec = "opus"
+	case bytes.Contains(head, []byte("\x01vorbis")):
+		codec = "vorbis"
+	}
+	return &unsupportedFormatError{
+		contentType: "audio/ogg",
+		detail:      fmt.Sprintf("ogg (%s) decode is not built into this binary; transcode upstream", codec),
+	}
+}
+
+// rejectAAC names the AAC container (ADTS stream vs M4A/MP4 box) in
+// the error. Like Opus, AAC decode is not in this binary: decoders are
+// cgo (fdk-aac) and no pure-Go one exists, so CDNs serving AAC need
+// upstream transcoding for now.
+func rejectAAC(r io.Reader) error {
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	container := "unknown container"
+	switch {
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xF6 == 0xF0:
+		container = "adts"
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		container = "m4a"
+	}
+	return &unsupportedFormatError{
+		contentType: "audio/aac",
+		detail:      fmt.Sprintf("aac (%s) decode is not built into this binary; transcode upstream", container),
+	}
+}
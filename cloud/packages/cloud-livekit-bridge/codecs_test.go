@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// decoderFor routes on content type first and URL extension as a
+// fallback; the registry is ordered, so an earlier decoder's claim
+// shadows a later one's. These cases pin that precedence down.
+func TestDecoderFor(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		urlPath     string
+		want        string // decoder name, "" for nil
+	}{
+		{"mp3 content type", "audio/mpeg", "", "mp3"},
+		{"mp3 alias", "audio/mp3", "", "mp3"},
+		{"wav content type", "audio/wav", "", "wav"},
+		{"hls content type", "application/vnd.apple.mpegurl", "", "hls"},
+		{"extension fallback", "application/octet-stream", "/tts/clip.mp3", "mp3"},
+		{"wav extension", "", "/sounds/chime.wav", "wav"},
+		{"m3u8 extension", "text/plain", "/radio/live.m3u8", "hls"},
+		// Content type wins over a conflicting extension: the CDN's
+		// header is trusted before the URL's suffix.
+		{"content type beats extension", "audio/mpeg", "/weird/name.wav", "mp3"},
+		{"ogg is recognized", "audio/ogg", "", "ogg"},
+		{"opus extension maps to ogg", "", "/tts/clip.opus", "ogg"},
+		{"aac is recognized", "audio/aac", "", "aac"},
+		{"m4a extension maps to aac", "", "/music/track.m4a", "aac"},
+		{"unknown", "application/octet-stream", "/blob/data.bin", ""},
+		{"empty", "", "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := decoderFor(tc.contentType, tc.urlPath)
+			got := ""
+			if d != nil {
+				got = d.name
+			}
+			if got != tc.want {
+				t.Errorf("decoderFor(%q, %q) = %q, want %q", tc.contentType, tc.urlPath, got, tc.want)
+			}
+		})
+	}
+}
+
+// Reject-only entries must return the typed unsupportedFormatError
+// naming the codec inside the container, so a developer sees "opus"
+// rather than a generic format complaint.
+func TestRejectOggNamesCodec(t *testing.T) {
+	head := append(make([]byte, 28), []byte("OpusHead")...)
+	err := rejectOgg(bytes.NewReader(head))
+	var ufe *unsupportedFormatError
+	if !errors.As(err, &ufe) {
+		t.Fatalf("rejectOgg returned %T, want *unsupportedFormatError", err)
+	}
+	if !strings.Contains(err.Error(), "opus") {
+		t.Errorf("rejectOgg error %q does not name opus", err)
+	}
+	if !strings.Contains(err.Error(), "supported:") {
+		t.Errorf("rejectOgg error %q does not list supported formats", err)
+	}
+}
+
+func TestRejectAACNamesContainer(t *testing.T) {
+	adts := []byte{0xFF, 0xF1, 0x50, 0x80, 0x00, 0x1F, 0xFC}
+	err := rejectAAC(bytes.NewReader(adts))
+	var ufe *unsupportedFormatError
+	if !errors.As(err, &ufe) {
+		t.Fatalf("rejectAAC returned %T, want *unsupportedFormatError", err)
+	}
+	if !strings.Contains(err.Error(), "adts") {
+		t.Errorf("rejectAAC error %q does not name the adts container", err)
+	}
+
+	m4a := []byte{0x00, 0x00, 0x00, 0x20, 'f', 't', 'y', 'p', 'M', '4', 'A', ' '}
+	err = rejectAAC(bytes.NewReader(m4a))
+	if !strings.Contains(err.Error(), "m4a") {
+		t.Errorf("rejectAAC error %q does not name the m4a container", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Gap concealment for the uplink: when inbound packets go missing past
+// the expected cadence (loss, or late beyond the jitter window), fill
+// frames are synthesized and forwarded ahead of the next real frame.
+// ASR tolerates concealment far better than hard gaps that splice
+// unrelated phonemes together.
+
+const (
+	// Gaps shorter than this ride on the downstream jitter buffer;
+	// longer ones get filled.
+	concealMinGap = 60 * time.Millisecond
+
+	// Never fabricate more than this much audio for one hole: past it
+	// the hole is a real dropout, not jitter, and silence is honest.
+	concealMaxFill = 500 * time.Millisecond
+
+	// Inbound audio is 16kHz mono PCM16LE regardless of the playback
+	// rate (the glasses mic path is fixed).
+	inboundBytesPerSecond = 16000 * 2
+)
+
+// gapConcealer synthesizes PCM16LE covering a hole in the inbound
+// stream. Implementations keep their own state and are fed from one
+// goroutine at a time (sessionConcealer serializes callers).
+type gapConcealer interface {
+	name() string
+	// conceal produces n bytes of fill given the last real frame.
+	conceal(last []byte, n int) []byte
+}
+
+// gapConcealerFactories is the pluggable registry, like the wake
+// detectors: "comfort" fills with low-level noise, "repeat" with the
+// last waveform decaying toward silence.
+var gapConcealerFactories = map[string]func() gapConcealer{
+	"comfort": newComfortNoiseConcealer,
+	"repeat":  newRepeatConcealer,
+}
+
+func newGapConcealer(name string) (gapConcealer, error) {
+	factory, ok := gapConcealerFactories[name]
+	if !ok {
+		names := make([]string, 0, len(gapConcealerFactories))
+		for n := range gapConcealerFactories {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown gap concealer %q (available: %v)", name, names)
+	}
+	return factory(), nil
+}
+
+// sessionConcealer tracks the inbound packet cadence and produces fill
+// for holes. Serialized like sessionWake: frames can arrive from the
+// UDP and LiveKit goroutines across a transport switch.
+type sessionConcealer struct {
+	mu     sync.Mutex
+	c      gapConcealer
+	lastAt time.Time
+	last   []byte
+}
+
+func newSessionConcealer(c gapConcealer) *sessionConcealer {
+	return &sessionConcealer{c: c}
+}
+
+// observe notes a real frame's arrival and returns fill covering the
+// hole before it (nil when the stream is on cadence).
+func (g *sessionConcealer) observe(frame []byte, now time.Time) []byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var fill []byte
+	if !g.lastAt.IsZero() && len(g.last) > 0 {
+		if gap := now.Sub(g.lastAt); gap > concealMinGap {
+			if gap > concealMaxFill {
+				gap = concealMaxFill
+			}
+			n := int(gap.Seconds()*inboundBytesPerSecond) &^ 1
+			fill = g.c.conceal(g.last, n)
+		}
+	}
+	g.lastAt = now
+	g.last = append(g.last[:0], frame...)
+	return fill
+}
+
+// comfortNoiseConcealer fills holes with noise at a fraction of the
+// last frame's level, keeping the channel "alive" for ASR without
+// inventing speech energy.
+type comfortNoiseConcealer struct {
+	rng *rand.Rand
+}
+
+func newComfortNoiseConcealer() gapConcealer {
+	return &comfortNoiseConcealer{rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (c *comfortNoiseConcealer) name() string { return "comfort" }
+
+func (c *comfortNoiseConcealer) conceal(last []byte, n int) []byte {
+	amp := bytesAvgAbs(last) / 8
+	if amp < 16 {
+		amp = 16
+	}
+	out := make([]byte, n)
+	for i := 0; i+1 < n; i += 2 {
+		v := int16(c.rng.Intn(int(2*amp+1)) - int(amp))
+		binary.LittleEndian.PutUint16(out[i:], uint16(v))
+	}
+	return out
+}
+
+// repeatConcealer fills holes by repeating the last waveform with
+// decaying gain, a cheap stand-in for waveform interpolation that
+// preserves pitch through short losses.
+type repeatConcealer struct{}
+
+func newRepeatConcealer() gapConcealer { return repeatConcealer{} }
+
+func (repeatConcealer) name() string { return "repeat" }
+
+func (repeatConcealer) conceal(last []byte, n int) []byte {
+	out := make([]byte, 0, n+len(last))
+	gain := 0.8
+	for len(out) < n {
+		chunk := make([]byte, len(last))
+		for i := 0; i+1 < len(last); i += 2 {
+			v := int16(binary.LittleEndian.Uint16(last[i:]))
+			binary.LittleEndian.PutUint16(chunk[i:], uint16(int16(float64(v)*gain)))
+		}
+		out = append(out, chunk...)
+		gain *= 0.6
+	}
+	return out[:n]
+}
+
+// bytesAvgAbs is the mean absolute sample of a PCM16LE buffer.
+func bytesAvgAbs(pcm []byte) int64 {
+	n := len(pcm) / 2
+	if n == 0 {
+		return 0
+	}
+	var sum int64
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := int64(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		if v < 0 {
+			v = -v
+		}
+		sum += v
+	}
+	return sum / int64(n)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds bridge configuration, loaded from the environment.
+// All values have sane defaults so the bridge can run with an empty env
+// in local development (docker-compose sets the real values).
+type Config struct {
+	// gRPC listen port for the TypeScript cloud
+	GRPCPort int
+
+	// UDP uplink audio listener port (0 disables the listener)
+	UDPPort int
+
+	// Public "host:port" endpoints handed to mobile clients at UDP
+	// registration, in preference order (comma-separated in the env)
+	UDPPublicAddrs []string
+
+	// Ping cadence expected from UDP clients, reported at registration
+	UDPPingInterval time.Duration
+
+	// Silence (no pings or audio) after which a registered user's UDP
+	// path is declared lost (0 disables the monitor)
+	UDPPingTimeout time.Duration
+
+	// Directory for admin-triggered UDP packet captures
+	UDPCaptureDir string
+
+	// Path for persisting UDP registrations across restarts
+	// (empty disables persistence)
+	UDPStateFile string
+
+	// Cap on registered UDP users; idle entries are LRU-evicted to make
+	// room when missed UnregisterUdpUser calls leak registrations
+	// (0 = unbounded)
+	UDPMaxUsers int
+
+	// Packet encryption key handed to clients (empty = disabled)
+	UDPEncryptionKey string
+
+	// HTTP timeout for PlayAudio fetches
+	AudioFetchTimeout time.Duration
+
+	// Retries for transient fetch failures (5xx, timeouts, resets) and
+	// the initial backoff, doubled per attempt (0 retries = fail fast)
+	AudioFetchRetries int
+	AudioFetchBackoff time.Duration
+
+	// Caps on fetched audio: downloaded bytes and decoded duration per
+	// clip (0 disables either). A mispointed URL fails with a typed
+	// AUDIO_TOO_LARGE / AUDIO_TOO_LONG event instead of tying up the
+	// track forever. Live RTSP/RTP feeds are exempt from the duration
+	// cap; ICY radio streams are not, so raise it for radio workloads.
+	AudioMaxBytes    int64
+	AudioMaxDuration time.Duration
+
+	// User-Agent sent on audio fetches (some providers filter default
+	// library agents); a request's own User-Agent header overrides it
+	AudioUserAgent string
+
+	// DNS cache TTL for audio hosts in the playback HTTP client
+	// (0 disables the caching dialer)
+	AudioDNSCacheTTL time.Duration
+
+	// Object-store access for s3:// and gs:// audio URIs. Each scheme
+	// gets an HMAC key pair (for GCS these are interoperability keys);
+	// with no keys configured the URI is rewritten to the plain HTTPS
+	// endpoint, which works for public buckets only.
+	S3Endpoint   string
+	S3Region     string
+	S3AccessKey  string
+	S3SecretKey  string
+	GSAccessKey  string
+	GSSecretKey  string
+	SignedURLTTL time.Duration
+
+	// Segment size for Range-based playback prefetch; the next segment
+	// downloads while the current one decodes (0 disables prefetch)
+	AudioPrefetchSegment int64
+
+	// TTS/CDN origins to connect to at startup (comma-separated URLs in
+	// the env, empty disables prewarming) and how often to re-touch them
+	// so the connections stay in the idle pool (0 = startup only)
+	AudioPrewarmOrigins  []string
+	AudioPrewarmInterval time.Duration
+
+	// LiveKit host to keep the dial path warm to (DNS + TLS handshake
+	// on the interval; empty disables it), shaving the cold-start cost
+	// off the first JoinRoom after a deploy or idle period
+	LiveKitPrewarmURL      string
+	LiveKitPrewarmInterval time.Duration
+
+	// Capacity of the per-session audioFromLiveKit channel.
+	// Frames beyond this are dropped (backpressure) rather than buffered.
+	AudioChannelSize int
+
+	// Log every N forwarded audio frames (0 disables periodic logging)
+	LogEveryFrames int
+
+	// How long a playback WriteSample may block before the track is
+	// considered stuck (peer gone, renegotiation wedged) and recreated.
+	PlaybackWriteTimeout time.Duration
+
+	// How far ahead of real time playback may run when pushing decoded
+	// audio into a track (the SDK buffers whatever is written). A small
+	// lead keeps StopAudio immediate and memory bounded on long files;
+	// 0 disables pacing and trusts the SDK's own backpressure.
+	PlaybackLeadBudget time.Duration
+
+	// How often an attached PlayAudio stream gets a PROGRESS event
+	// while its clip plays (0 disables progress events). Detached and
+	// queued playbacks have no stream to send them on.
+	PlaybackProgressInterval time.Duration
+
+	// Sample rate (Hz) playback decodes to and publishes at. 16000
+	// matches the glasses audio path; rooms negotiating full-band Opus
+	// should run 48000 so wideband sources keep their fidelity. One
+	// rate per instance — route high-fidelity rooms to a dedicated
+	// deployment rather than mixing rates.
+	PlaybackSampleRate int
+
+	// Max simultaneous PlayAudio decode loops per session; extra
+	// requests fail with RESOURCE_EXHAUSTED (0 = unbounded)
+	MaxConcurrentPlaybacks int
+
+	// Shared decoded-PCM cache budget (0 disables the cache) and entry TTL
+	AudioCacheMaxBytes int64
+	AudioCacheTTL      time.Duration
+
+	// Path for persisting per-user preferences across restarts
+	// (empty keeps them in memory only)
+	PrefsFile string
+
+	// Wake-word detector run over inbound audio, emitting WAKE_DETECTED
+	// events ("" disables; "energy" is the built-in placeholder)
+	WakeDetector string
+
+	// Sound-event classifier run over inbound audio, emitting
+	// SOUND_DETECTED events ("" disables; "tonal" is the built-in
+	// reference implementation)
+	SoundClassifier string
+
+	// Uplink gap concealment run over inbound audio before it reaches
+	// ASR ("" disables; "comfort" fills holes with low-level noise,
+	// "repeat" with the last waveform decaying to silence)
+	GapConcealer string
+
+	// Interval between heartbeat chunks on the bridge → cloud side of
+	// StreamAudio (0 disables heartbeats).
+	StreamHeartbeatInterval time.Duration
+
+	// Interval between per-session SESSION_METRICS events on the
+	// SubscribeEvents stream (0 disables them).
+	SessionMetricsInterval time.Duration
+
+	// How long shutdown waits for clients to migrate off this instance
+	// after the SHUTTING_DOWN announcement before streams are cut.
+	DrainTimeout time.Duration
+
+	// Run the boot self-test (pipeline + UDP loopback) and refuse to
+	// start if it fails
+	SelfTest bool
+
+	// Diagnostic A/B mode: run the sinc resampler alongside linear on
+	// every playback and log per-clip SNR/latency differences
+	ResamplerAB bool
+
+	// Playback DSP chain ("gain|compressor:threshold=0.1" style specs;
+	// empty = just the request-volume gain stage) and per-track overrides
+	// ("1=gain|limiter:ceiling=0.9;2=gain")
+	DSPChain       []string
+	DSPTrackChains map[int32][]string
+
+	// Append-only JSONL sink for the RPC audit log (empty = in-memory
+	// ring only) and the ring's capacity
+	AuditFile   string
+	AuditBuffer int
+
+	// Shared key for encrypting ExportSession blobs (empty disables the
+	// export/import RPCs)
+	SessionExportKey string
+
+	// Stable instance identifier for placement (defaults to hostname)
+	InstanceID string
+
+	// Deployment region reported to placement (empty if not configured)
+	Region string
+
+	// Session capacity reported to placement (0 = unbounded)
+	MaxSessions int
+
+	// Tenant API keys ("key=tenant;key2=tenant2"). When set, every RPC
+	// must carry a known key in x-bridge-tenant-key metadata and
+	// sessions are scoped to the authenticated tenant. Empty runs
+	// single-tenant with no key check.
+	TenantKeys map[string]string
+
+	// Per-tenant session cap when tenants are configured (0 = unbounded)
+	TenantMaxSessions int
+
+	// Embedded HTTP admin UI for incident support (0 disables; the
+	// token is mandatory, there is no unauthenticated mode)
+	AdminPort  int
+	AdminToken string
+}
+
+// LoadConfig reads configuration from environment variables.
+func LoadConfig() *Config {
+	return &Config{
+		GRPCPort:                 envInt("BRIDGE_GRPC_PORT", 9090),
+		UDPPort:                  envInt("BRIDGE_UDP_PORT", 8000),
+		UDPPublicAddrs:           envList("BRIDGE_UDP_PUBLIC_ADDRS"),
+		UDPPingInterval:          time.Duration(envInt("BRIDGE_UDP_PING_INTERVAL_MS", 3000)) * time.Millisecond,
+		UDPPingTimeout:           time.Duration(envInt("BRIDGE_UDP_PING_TIMEOUT_SEC", 10)) * time.Second,
+		UDPCaptureDir:            envStr("BRIDGE_UDP_CAPTURE_DIR", os.TempDir()),
+		UDPMaxUsers:              envInt("BRIDGE_UDP_MAX_USERS", 10000),
+		UDPStateFile:             envStr("BRIDGE_UDP_STATE_FILE", ""),
+		UDPEncryptionKey:         envStr("BRIDGE_UDP_ENCRYPTION_KEY", ""),
+		AudioFetchTimeout:        time.Duration(envInt("BRIDGE_AUDIO_FETCH_TIMEOUT_SEC", 30)) * time.Second,
+		AudioFetchRetries:        envInt("BRIDGE_AUDIO_FETCH_RETRIES", 2),
+		AudioFetchBackoff:        time.Duration(envInt("BRIDGE_AUDIO_FETCH_BACKOFF_MS", 250)) * time.Millisecond,
+		AudioMaxBytes:            int64(envInt("BRIDGE_AUDIO_MAX_MB", 50)) << 20,
+		AudioMaxDuration:         time.Duration(envInt("BRIDGE_AUDIO_MAX_DURATION_SEC", 600)) * time.Second,
+		AudioUserAgent:           envStr("BRIDGE_AUDIO_USER_AGENT", "mentra-livekit-bridge/1.0"),
+		AudioDNSCacheTTL:         time.Duration(envInt("BRIDGE_AUDIO_DNS_TTL_SEC", 60)) * time.Second,
+		S3Endpoint:               envStr("BRIDGE_S3_ENDPOINT", "s3.amazonaws.com"),
+		S3Region:                 envStr("BRIDGE_S3_REGION", "us-east-1"),
+		S3AccessKey:              envStr("BRIDGE_S3_ACCESS_KEY", ""),
+		S3SecretKey:              envStr("BRIDGE_S3_SECRET_KEY", ""),
+		GSAccessKey:              envStr("BRIDGE_GS_ACCESS_KEY", ""),
+		GSSecretKey:              envStr("BRIDGE_GS_SECRET_KEY", ""),
+		SignedURLTTL:             time.Duration(envInt("BRIDGE_SIGNED_URL_TTL_SEC", 900)) * time.Second,
+		AudioPrefetchSegment:     int64(envInt("BRIDGE_AUDIO_PREFETCH_KB", 256)) << 10,
+		AudioPrewarmOrigins:      envList("BRIDGE_AUDIO_PREWARM_ORIGINS"),
+		AudioPrewarmInterval:     time.Duration(envInt("BRIDGE_AUDIO_PREWARM_INTERVAL_SEC", 60)) * time.Second,
+		LiveKitPrewarmURL:        envStr("BRIDGE_LIVEKIT_PREWARM_URL", ""),
+		LiveKitPrewarmInterval:   time.Duration(envInt("BRIDGE_LIVEKIT_PREWARM_INTERVAL_SEC", 30)) * time.Second,
+		AudioChannelSize:         envInt("BRIDGE_AUDIO_CHANNEL_SIZE", 100),
+		LogEveryFrames:           envInt("BRIDGE_LOG_EVERY_FRAMES", 100),
+		PlaybackWriteTimeout:     time.Duration(envInt("BRIDGE_PLAYBACK_WRITE_TIMEOUT_SEC", 5)) * time.Second,
+		PlaybackLeadBudget:       time.Duration(envInt("BRIDGE_PLAYBACK_LEAD_MS", 200)) * time.Millisecond,
+		PlaybackProgressInterval: time.Duration(envInt("BRIDGE_PLAYBACK_PROGRESS_SEC", 5)) * time.Second,
+		PlaybackSampleRate:       envInt("BRIDGE_PLAYBACK_SAMPLE_RATE", 16000),
+		MaxConcurrentPlaybacks:   envInt("BRIDGE_MAX_PLAYBACKS_PER_SESSION", 3),
+		AudioCacheMaxBytes:       int64(envInt("BRIDGE_AUDIO_CACHE_MB", 64)) << 20,
+		AudioCacheTTL:            time.Duration(envInt("BRIDGE_AUDIO_CACHE_TTL_SEC", 300)) * time.Second,
+		PrefsFile:                envStr("BRIDGE_PREFS_FILE", ""),
+		WakeDetector:             envStr("BRIDGE_WAKE_DETECTOR", ""),
+		SoundClassifier:          envStr("BRIDGE_SOUND_CLASSIFIER", ""),
+		GapConcealer:             envStr("BRIDGE_GAP_CONCEALER", ""),
+		StreamHeartbeatInterval:  time.Duration(envInt("BRIDGE_STREAM_HEARTBEAT_SEC", 5)) * time.Second,
+		SessionMetricsInterval:   time.Duration(envInt("BRIDGE_SESSION_METRICS_SEC", 10)) * time.Second,
+		DrainTimeout:             time.Duration(envInt("BRIDGE_DRAIN_TIMEOUT_SEC", 10)) * time.Second,
+		SelfTest:                 envInt("BRIDGE_SELFTEST", 0) != 0,
+		ResamplerAB:              envInt("BRIDGE_RESAMPLER_AB", 0) != 0,
+		DSPChain:                 parseChainSpec(envStr("BRIDGE_DSP_CHAIN", "")),
+		DSPTrackChains:           parseTrackChainSpecs(envStr("BRIDGE_DSP_TRACK_CHAINS", "")),
+		AuditFile:                envStr("BRIDGE_AUDIT_FILE", ""),
+		AuditBuffer:              envInt("BRIDGE_AUDIT_BUFFER", 1024),
+		SessionExportKey:         envStr("BRIDGE_SESSION_EXPORT_KEY", ""),
+		InstanceID:               envStr("BRIDGE_INSTANCE_ID", defaultInstanceID()),
+		Region:                   envStr("BRIDGE_REGION", ""),
+		MaxSessions:              envInt("BRIDGE_MAX_SESSIONS", 0),
+		TenantKeys:               parseTenantKeys(envStr("BRIDGE_TENANT_KEYS", "")),
+		TenantMaxSessions:        envInt("BRIDGE_TENANT_MAX_SESSIONS", 0),
+		AdminPort:                envInt("BRIDGE_ADMIN_PORT", 0),
+		AdminToken:               envStr("BRIDGE_ADMIN_TOKEN", ""),
+	}
+}
+
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func envStr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envList parses a comma-separated env var into a slice (empty → nil).
+func envList(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
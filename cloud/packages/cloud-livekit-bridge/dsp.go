@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The playback DSP pipeline is an ordered chain of stages applied to
+// every 16kHz mono block before it reaches the track. The chain is
+// configured as a spec string ("gain|compressor:threshold=0.1,ratio=3"),
+// globally and with per-track overrides, so new effects plug in via
+// dspStageFactories without touching the decode loops in playback.go.
+// Resampling stays structural (it changes the block length) and always
+// runs before the chain.
+
+// dspStage processes a block of 16kHz mono samples in place. Instances
+// are created per playback, so stages may keep filter state across
+// blocks without locking.
+type dspStage interface {
+	name() string
+	process(samples []int16)
+}
+
+// dspChain is an ordered list of stages run front to back.
+type dspChain []dspStage
+
+func (c dspChain) process(samples []int16) {
+	for _, stage := range c {
+		stage.process(samples)
+	}
+}
+
+// dspStageFactories maps stage names to constructors. volume is the
+// playback request's effective volume; most stages ignore it.
+var dspStageFactories = map[string]func(params map[string]float64, volume float64) (dspStage, error){
+	"gain":       newGainStage,
+	"eq":         newEQStage,
+	"compressor": newCompressorStage,
+	"limiter":    newLimiterStage,
+	"softlimit":  newSoftLimiterStage,
+	"loudnorm":   newLoudnormStage,
+}
+
+// newDSPChain builds a chain from stage specs. An empty spec list means
+// the default chain: just the request-volume gain stage, which matches
+// the pre-chain pipeline exactly.
+func newDSPChain(specs []string, volume float64) (dspChain, error) {
+	if len(specs) == 0 {
+		specs = []string{"gain"}
+	}
+	chain := make(dspChain, 0, len(specs))
+	for _, spec := range specs {
+		name, params, err := parseStageSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		factory, ok := dspStageFactories[name]
+		if !ok {
+			known := make([]string, 0, len(dspStageFactories))
+			for k := range dspStageFactories {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown dsp stage %q (known: %s)", name, strings.Join(known, ", "))
+		}
+		stage, err := factory(params, volume)
+		if err != nil {
+			return nil, fmt.Errorf("dsp stage %s: %w", name, err)
+		}
+		chain = append(chain, stage)
+	}
+	return chain, nil
+}
+
+// parseStageSpec splits "name:key=val,key=val" into its parts.
+func parseStageSpec(spec string) (string, map[string]float64, error) {
+	name, rest, hasParams := strings.Cut(strings.TrimSpace(spec), ":")
+	params := map[string]float64{}
+	if !hasParams {
+		return name, params, nil
+	}
+	for _, kv := range strings.Split(rest, ",") {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("bad dsp param %q in %q (want key=value)", kv, spec)
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("bad dsp param %q in %q: %w", kv, spec, err)
+		}
+		params[strings.TrimSpace(key)] = f
+	}
+	return name, params, nil
+}
+
+// param reads a stage parameter with a default.
+func param(params map[string]float64, key string, def float64) float64 {
+	if v, ok := params[key]; ok {
+		return v
+	}
+	return def
+}
+
+// gainStage scales by the request volume times an optional fixed
+// multiplier ("gain:mul=1.5"), clipping at the int16 rails.
+type gainStage struct {
+	gain float64
+}
+
+func newGainStage(params map[string]float64, volume float64) (dspStage, error) {
+	return &gainStage{gain: volume * param(params, "mul", 1.0)}, nil
+}
+
+func (g *gainStage) name() string { return "gain" }
+
+func (g *gainStage) process(samples []int16) {
+	applyGain(samples, g.gain)
+}
+
+// eqStage is a first-order tilt EQ: the signal is split by a one-pole
+// low-pass and the bands are rebalanced ("eq:low=0.8,high=1.2"). The
+// crossover ("fc", Hz) defaults to 1kHz.
+type eqStage struct {
+	low, high float64
+	alpha     float64
+	state     float64
+}
+
+func newEQStage(params map[string]float64, _ float64) (dspStage, error) {
+	fc := param(params, "fc", 1000)
+	if fc <= 0 || fc >= float64(playbackSampleRate)/2 {
+		return nil, fmt.Errorf("fc %g out of range (0, %d)", fc, playbackSampleRate/2)
+	}
+	// One-pole coefficient: dt/(rc+dt) with rc = 1/(2*pi*fc).
+	dt := 1.0 / float64(playbackSampleRate)
+	rc := 1.0 / (2 * math.Pi * fc)
+	return &eqStage{
+		low:   param(params, "low", 1.0),
+		high:  param(params, "high", 1.0),
+		alpha: dt / (rc + dt),
+	}, nil
+}
+
+func (e *eqStage) name() string { return "eq" }
+
+func (e *eqStage) process(samples []int16) {
+	for i, s := range samples {
+		x := float64(s)
+		e.state += e.alpha * (x - e.state)
+		v := e.low*e.state + e.high*(x-e.state)
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		samples[i] = int16(v)
+	}
+}
+
+// compressorStage is the same static waveshaper as drcProfile, exposed
+// with inline params ("compressor:threshold=0.1,ratio=3,makeup=1.5").
+type compressorStage struct {
+	threshold, ratio, makeup float64
+}
+
+func newCompressorStage(params map[string]float64, _ float64) (dspStage, error) {
+	c := &compressorStage{
+		threshold: param(params, "threshold", 0.1),
+		ratio:     param(params, "ratio", 2),
+		makeup:    param(params, "makeup", 1),
+	}
+	if c.ratio < 1 {
+		return nil, fmt.Errorf("ratio %g must be >= 1", c.ratio)
+	}
+	return c, nil
+}
+
+func (c *compressorStage) name() string { return "compressor" }
+
+func (c *compressorStage) process(samples []int16) {
+	for i, s := range samples {
+		v := float64(s) / 32768
+		a := v
+		if a < 0 {
+			a = -a
+		}
+		if a > c.threshold {
+			a = c.threshold + (a-c.threshold)/c.ratio
+		}
+		a *= c.makeup
+		if a > 1 {
+			a = 1
+		}
+		if v < 0 {
+			a = -a
+		}
+		samples[i] = int16(a * 32767)
+	}
+}
+
+// limiterStage hard-caps at a full-scale fraction ("limiter:ceiling=0.9").
+type limiterStage struct {
+	ceiling int16
+}
+
+func newLimiterStage(params map[string]float64, _ float64) (dspStage, error) {
+	ceiling := param(params, "ceiling", 1.0)
+	if ceiling <= 0 || ceiling > 1 {
+		return nil, fmt.Errorf("ceiling %g out of range (0, 1]", ceiling)
+	}
+	return &limiterStage{ceiling: int16(ceiling * 32767)}, nil
+}
+
+func (l *limiterStage) name() string { return "limiter" }
+
+func (l *limiterStage) process(samples []int16) {
+	for i, s := range samples {
+		if s > l.ceiling {
+			samples[i] = l.ceiling
+		} else if s < -l.ceiling {
+			samples[i] = -l.ceiling
+		}
+	}
+}
+
+// softLimiterStage is a soft-knee peak limiter
+// ("softlimit:threshold=0.85,knee=0.1,release=50"). Where applyGain and
+// the hard limiter clip flat at the rail — audibly harsh on the glasses
+// speakers — this tracks the signal envelope (instant attack,
+// exponential release over "release" ms) and bends levels entering the
+// knee smoothly down so peaks settle at the threshold instead of
+// shearing off. Because the gain follows the envelope rather than each
+// sample, loud passages duck briefly and recover instead of distorting.
+type softLimiterStage struct {
+	threshold float64 // full-scale fraction where limiting holds the level
+	knee      float64 // half-width of the soft knee around the threshold
+	release   float64 // per-sample envelope decay coefficient
+	env       float64
+}
+
+func newSoftLimiterStage(params map[string]float64, _ float64) (dspStage, error) {
+	l := &softLimiterStage{
+		threshold: param(params, "threshold", 0.85),
+		knee:      param(params, "knee", 0.1),
+	}
+	if l.threshold <= 0 || l.threshold > 1 {
+		return nil, fmt.Errorf("threshold %g out of range (0, 1]", l.threshold)
+	}
+	if l.knee < 0 || l.knee >= l.threshold {
+		return nil, fmt.Errorf("knee %g out of range [0, threshold)", l.knee)
+	}
+	releaseMs := param(params, "release", 50)
+	if releaseMs < 1 || releaseMs > 1000 {
+		return nil, fmt.Errorf("release %g out of range [1, 1000] ms", releaseMs)
+	}
+	l.release = math.Exp(-1000.0 / (releaseMs * float64(playbackSampleRate)))
+	return l, nil
+}
+
+func (l *softLimiterStage) name() string { return "softlimit" }
+
+func (l *softLimiterStage) process(samples []int16) {
+	for i, s := range samples {
+		x := float64(s) / 32768
+		a := math.Abs(x)
+		if a > l.env {
+			l.env = a
+		} else {
+			l.env = a + (l.env-a)*l.release
+		}
+		// Target output level for the current envelope: unity below the
+		// knee, quadratic through it, flat at the threshold above it.
+		out := l.env
+		if l.knee > 0 && l.env > l.threshold-l.knee && l.env < l.threshold+l.knee {
+			d := l.env - (l.threshold - l.knee)
+			out = l.env - d*d/(4*l.knee)
+		} else if l.env >= l.threshold+l.knee {
+			out = l.threshold
+		}
+		if l.env > 1e-6 && out < l.env {
+			x *= out / l.env
+		}
+		v := x * 32767
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		samples[i] = int16(v)
+	}
+}
+
+// loudnormGate is the absolute gate (LUFS): blocks quieter than this
+// are left out of the loudness measurement, so silence and inter-item
+// gaps don't drive the gain up.
+const loudnormGate = -70
+
+// loudnormSmoothing moves the applied gain toward the measured target
+// per ~100ms block; ~0.5s to settle, slow enough not to pump.
+const loudnormSmoothing = 0.2
+
+// loudnormStage normalizes loudness toward a LUFS target
+// ("loudnorm:target=-16,window=3,maxgain=4,ceiling=0.95"), so TTS
+// providers and sound assets with wildly different mastering land at
+// the same level. Loudness is measured R128-style — gated mean square
+// over a sliding window — with a one-pole 60Hz high-pass standing in
+// for the RLB curve: mono speech at 16kHz has no content where the
+// K-weighting shelf matters. The gained signal is kept under a
+// true-peak ceiling by also checking inter-sample midpoints.
+type loudnormStage struct {
+	target  float64 // LUFS
+	maxGain float64 // boost cap; attenuation is unbounded
+	ceiling float64 // fraction of full scale
+
+	hpAlpha float64
+	hpState float64
+
+	// Sliding window of per-block mean squares (~100ms blocks).
+	window []float64
+	next   int
+	filled bool
+
+	gain float64
+}
+
+func newLoudnormStage(params map[string]float64, _ float64) (dspStage, error) {
+	l := &loudnormStage{
+		target:  param(params, "target", -16),
+		maxGain: param(params, "maxgain", 4),
+		ceiling: param(params, "ceiling", 0.95),
+		gain:    1,
+	}
+	if l.target >= 0 || l.target < loudnormGate {
+		return nil, fmt.Errorf("target %g out of range [%d, 0)", l.target, loudnormGate)
+	}
+	if l.maxGain < 1 {
+		return nil, fmt.Errorf("maxgain %g must be >= 1", l.maxGain)
+	}
+	if l.ceiling <= 0 || l.ceiling > 1 {
+		return nil, fmt.Errorf("ceiling %g out of range (0, 1]", l.ceiling)
+	}
+	windowSec := param(params, "window", 3)
+	if windowSec < 0.5 || windowSec > 30 {
+		return nil, fmt.Errorf("window %g out of range [0.5, 30]", windowSec)
+	}
+	dt := 1.0 / float64(playbackSampleRate)
+	rc := 1.0 / (2 * math.Pi * 60)
+	l.hpAlpha = dt / (rc + dt)
+	l.window = make([]float64, int(windowSec*10))
+	return l, nil
+}
+
+func (l *loudnormStage) name() string { return "loudnorm" }
+
+func (l *loudnormStage) process(samples []int16) {
+	if len(samples) == 0 {
+		return
+	}
+	// Measure the block: high-passed mean square, gated into the window.
+	var sum float64
+	for _, s := range samples {
+		x := float64(s) / 32768
+		l.hpState += l.hpAlpha * (x - l.hpState)
+		w := x - l.hpState
+		sum += w * w
+	}
+	ms := sum / float64(len(samples))
+	if -0.691+10*math.Log10(ms+1e-12) > loudnormGate {
+		l.window[l.next] = ms
+		l.next = (l.next + 1) % len(l.window)
+		if l.next == 0 {
+			l.filled = true
+		}
+	}
+	// Integrated loudness over the window drives the smoothed gain.
+	n := l.next
+	if l.filled {
+		n = len(l.window)
+	}
+	if n > 0 {
+		var total float64
+		for i := 0; i < n; i++ {
+			total += l.window[i]
+		}
+		loudness := -0.691 + 10*math.Log10(total/float64(n)+1e-12)
+		want := math.Pow(10, (l.target-loudness)/20)
+		if want > l.maxGain {
+			want = l.maxGain
+		}
+		l.gain += loudnormSmoothing * (want - l.gain)
+	}
+	// Keep the gained block under the ceiling. Sample peaks understate
+	// true peak, so inter-sample values are estimated with 4-point
+	// cubic interpolation at the midpoints (which, unlike linear, can
+	// overshoot the neighbouring samples the way a converter does).
+	eff := l.gain
+	var peak float64
+	for i, s := range samples {
+		if x := math.Abs(float64(s)) / 32768; x > peak {
+			peak = x
+		}
+		if i >= 1 && i+2 < len(samples) {
+			m := -float64(samples[i-1]) + 9*float64(s) + 9*float64(samples[i+1]) - float64(samples[i+2])
+			if x := math.Abs(m) / 16 / 32768; x > peak {
+				peak = x
+			}
+		}
+	}
+	if peak*eff > l.ceiling {
+		eff = l.ceiling / peak
+	}
+	applyGain(samples, eff)
+}
+
+// parseChainSpec splits a "stage|stage:params" string into stage specs.
+// "|" separates stages because stage params use commas.
+func parseChainSpec(s string) []string {
+	var specs []string
+	for _, part := range strings.Split(s, "|") {
+		if part = strings.TrimSpace(part); part != "" {
+			specs = append(specs, part)
+		}
+	}
+	return specs
+}
+
+// validateDSPConfig builds every configured chain once at startup so a
+// typo in the env is one loud log line instead of a surprise on the
+// first playback. Invalid chains are cleared back to the default.
+func validateDSPConfig(config *Config) {
+	if _, err := newDSPChain(config.DSPChain, 1.0); err != nil {
+		log.Printf("invalid BRIDGE_DSP_CHAIN: %v (using default)", err)
+		config.DSPChain = nil
+	}
+	for track, specs := range config.DSPTrackChains {
+		if _, err := newDSPChain(specs, 1.0); err != nil {
+			log.Printf("invalid dsp chain for track %d: %v (using default)", track, err)
+			delete(config.DSPTrackChains, track)
+		}
+	}
+}
+
+// parseTrackChainSpecs parses per-track overrides of the form
+// "1=gain|limiter:ceiling=0.9;2=gain". Bad entries are logged and
+// skipped rather than failing startup.
+func parseTrackChainSpecs(s string) map[int32][]string {
+	if s == "" {
+		return nil
+	}
+	out := make(map[int32][]string)
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		trackStr, chainStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Printf("ignoring bad track dsp entry %q (want track=chain)", entry)
+			continue
+		}
+		track, err := strconv.Atoi(strings.TrimSpace(trackStr))
+		if err != nil {
+			log.Printf("ignoring bad track dsp entry %q: %v", entry, err)
+			continue
+		}
+		out[int32(track)] = parseChainSpec(chainStr)
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Emergency broadcast: one RPC that cuts through whatever is playing on
+// every (or a filtered set of) sessions, for enterprise safety
+// deployments — evacuation alerts, lockdown announcements. Active
+// playbacks are paused rather than stopped, so the interrupted audio
+// resumes where it left off once the alert has played. Audio policy is
+// deliberately not consulted: quiet hours must not silence an alarm.
+
+// Alert volume floor and ceiling: an emergency clip may be neither
+// inaudible nor painful, whatever the request says.
+const (
+	emergencyMinVolume = 0.3
+	emergencyMaxVolume = 1.0
+)
+
+// EmergencyBroadcast plays a clip to many sessions at once, pausing and
+// then resuming whatever each of them was playing.
+func (s *LiveKitBridgeService) EmergencyBroadcast(ctx context.Context, req *pb.EmergencyBroadcastRequest) (*pb.EmergencyBroadcastResponse, error) {
+	if req.RequestId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "request_id required")
+	}
+	if req.AudioUrl == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "audio_url required")
+	}
+	if isLiveSource(req.AudioUrl) {
+		return nil, status.Errorf(codes.InvalidArgument, "broadcast clip must be a finite file, not a live source")
+	}
+	volume := volumeOrDefault(req.Volume)
+	if volume < emergencyMinVolume {
+		volume = emergencyMinVolume
+	} else if volume > emergencyMaxVolume {
+		volume = emergencyMaxVolume
+	}
+
+	// One fetch and decode for the whole fleet; per-session failures
+	// must not depend on the origin staying up during fan-out.
+	pcm, err := s.fetchDecodedPCM(ctx, req.AudioUrl, nil)
+	if err != nil {
+		return &pb.EmergencyBroadcastResponse{Success: false, Error: err.Error()}, nil
+	}
+
+	tenant := tenantFromContext(ctx)
+	var sessions []*RoomSession
+	s.mu.Lock()
+	if len(req.UserIds) == 0 {
+		for _, session := range s.sessions {
+			sessions = append(sessions, session)
+		}
+	} else {
+		for _, userID := range req.UserIds {
+			if session, ok := s.sessions[userID]; ok {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	log.Printf("emergency broadcast %s to %d sessions (volume=%.2f): %s",
+		req.RequestId, len(sessions), volume, req.Reason)
+
+	var delivered, failed atomic.Int32
+	var wg sync.WaitGroup
+	for _, session := range sessions {
+		if session.tenant != tenant {
+			continue
+		}
+		wg.Add(1)
+		go func(session *RoomSession) {
+			defer wg.Done()
+			if err := s.broadcastToSession(session, req, volume, pcm); err != nil {
+				log.Printf("emergency broadcast %s failed for user %s: %v", req.RequestId, session.userID, err)
+				failed.Add(1)
+				return
+			}
+			delivered.Add(1)
+		}(session)
+	}
+	wg.Wait()
+
+	log.Printf("emergency broadcast %s done: delivered=%d failed=%d",
+		req.RequestId, delivered.Load(), failed.Load())
+	return &pb.EmergencyBroadcastResponse{
+		Success:   true,
+		Delivered: delivered.Load(),
+		Failed:    failed.Load(),
+	}, nil
+}
+
+// broadcastToSession pauses the session's tracks, plays the clip on the
+// reserved emergency track, and resumes what was paused. The playback
+// is registered normally, so StopAudio can still cut a botched alert.
+func (s *LiveKitBridgeService) broadcastToSession(session *RoomSession, req *pb.EmergencyBroadcastRequest, volume float32, pcm []int16) error {
+	paused := session.pauseAll()
+	defer func() {
+		for _, trackID := range paused {
+			session.resumePlayback(trackID)
+		}
+	}()
+
+	playReq := &pb.PlayAudioRequest{
+		RequestId: req.RequestId,
+		UserId:    session.userID,
+		AudioUrl:  req.AudioUrl,
+		TrackId:   TrackIDEmergency,
+		Volume:    volume,
+	}
+	playCtx, cancel := context.WithCancel(session.ctx)
+	defer cancel()
+	// No concurrency cap: the paused playbacks still count, and an alert
+	// must not fail because the session was busy.
+	if _, err := session.beginPlayback(TrackIDEmergency, req.RequestId, "", cancel, 0, 0); err != nil {
+		return err
+	}
+	defer session.endPlayback(TrackIDEmergency, req.RequestId)
+	_, err := s.playFromPCM(playCtx, session, playReq, pcm)
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// eventHub fans session lifecycle events out to SubscribeEvents streams.
+// Subscribers with full channels miss events rather than blocking emitters;
+// the event stream is advisory, the RPC responses are the source of truth.
+type eventHub struct {
+	mu     sync.Mutex
+	nextID int64
+	subs   map[int64]*eventSub
+}
+
+type eventSub struct {
+	userID string // empty = all users
+	ch     chan *pb.BridgeEvent
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[int64]*eventSub)}
+}
+
+func (h *eventHub) subscribe(userID string) (int64, <-chan *pb.BridgeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	id := h.nextID
+	sub := &eventSub{userID: userID, ch: make(chan *pb.BridgeEvent, 32)}
+	h.subs[id] = sub
+	return id, sub.ch
+}
+
+func (h *eventHub) unsubscribe(id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, id)
+}
+
+func (h *eventHub) publish(ev *pb.BridgeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subs {
+		if sub.userID != "" && sub.userID != ev.UserId {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			// Subscriber not draining; drop rather than block the session.
+		}
+	}
+}
+
+// SubscribeEvents streams session lifecycle events to the cloud until the
+// client disconnects.
+func (s *LiveKitBridgeService) SubscribeEvents(req *pb.SubscribeEventsRequest, stream pb.LiveKitBridge_SubscribeEventsServer) error {
+	id, ch := s.events.subscribe(req.UserId)
+	defer s.events.unsubscribe(id)
+	log.Printf("event subscriber %d attached (user=%q)", id, req.UserId)
+
+	for {
+		select {
+		case ev := <-ch:
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
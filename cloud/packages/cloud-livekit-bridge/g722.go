@@ -0,0 +1,258 @@
+package main
+
+// ITU-T G.722 decoder (64 kbit/s mode), translated from the public
+// reference structure (sub-band ADPCM: 6-bit low band + 2-bit high band
+// per octet, QMF synthesis to 16 kHz PCM). Some glasses encode the BLE
+// uplink as G.722 so the phone can forward frames untouched instead of
+// transcoding to PCM; the bridge decodes them here (see udp_audio.go).
+//
+// LC3 — the other codec those glasses speak — is deliberately absent:
+// like Opus, the available decoders are C libraries and this build is
+// pure Go with no cgo (see rejectOgg in codecs.go), so LC3 frames still
+// need phone-side transcoding.
+//
+// The decoder is stateful across frames. Packet loss desynchronizes the
+// adaptive predictors briefly, but ADPCM converges back within a few
+// tens of milliseconds, which is why the caller does not reset state on
+// sequence gaps.
+
+var (
+	g722WL   = [8]int{-60, -30, 58, 172, 334, 538, 1198, 3042}
+	g722RL42 = [16]int{0, 7, 6, 5, 4, 3, 2, 1, 7, 6, 5, 4, 3, 2, 1, 0}
+	g722ILB  = [32]int{
+		2048, 2093, 2139, 2186, 2233, 2282, 2332, 2383,
+		2435, 2489, 2543, 2599, 2656, 2714, 2774, 2834,
+		2896, 2960, 3025, 3091, 3158, 3228, 3298, 3371,
+		3444, 3520, 3597, 3676, 3756, 3838, 3922, 4008,
+	}
+	g722WH  = [3]int{0, -214, 798}
+	g722RH2 = [4]int{2, 1, 2, 1}
+	g722QM2 = [4]int{-7408, -1616, 7408, 1616}
+	g722QM4 = [16]int{
+		0, -20456, -12896, -8968, -6288, -4240, -2584, -1200,
+		20456, 12896, 8968, 6288, 4240, 2584, 1200, 0,
+	}
+	g722QM6 = [64]int{
+		-136, -136, -136, -136, -24808, -21904, -19008, -16704,
+		-14984, -13512, -12280, -11192, -10232, -9360, -8576, -7856,
+		-7192, -6576, -6000, -5456, -4944, -4464, -4008, -3576,
+		-3168, -2776, -2400, -2032, -1688, -1360, -1040, -728,
+		24808, 21904, 19008, 16704, 14984, 13512, 12280, 11192,
+		10232, 9360, 8576, 7856, 7192, 6576, 6000, 5456,
+		4944, 4464, 4008, 3576, 3168, 2776, 2400, 2032,
+		1688, 1360, 1040, 728, 432, 136, -432, -136,
+	}
+	g722QMF = [12]int{3, -11, 12, 32, -210, 951, 3876, -805, 362, -156, 53, -11}
+)
+
+// g722Band is one sub-band's adaptive predictor state.
+type g722Band struct {
+	s   int
+	sp  int
+	sz  int
+	r   [3]int
+	a   [3]int
+	ap  [3]int
+	p   [3]int
+	d   [7]int
+	b   [7]int
+	bp  [7]int
+	sg  [7]int
+	nb  int
+	det int
+}
+
+// g722Decoder decodes a G.722 octet stream. One decoder per sender:
+// the predictor state carries across frames.
+type g722Decoder struct {
+	band [2]g722Band // [0] low band, [1] high band
+	x    [24]int     // QMF synthesis delay line
+}
+
+func newG722Decoder() *g722Decoder {
+	d := &g722Decoder{}
+	d.band[0].det = 32
+	d.band[1].det = 8
+	return d
+}
+
+func g722Saturate(v int) int {
+	if v > 32767 {
+		return 32767
+	}
+	if v < -32768 {
+		return -32768
+	}
+	return v
+}
+
+// decode expands G.722 octets to 16 kHz PCM, two samples per octet.
+func (g *g722Decoder) decode(data []byte) []int16 {
+	out := make([]int16, 0, len(data)*2)
+	for _, code := range data {
+		wd1 := int(code) & 0x3F
+		ihigh := (int(code) >> 6) & 0x03
+		wd2 := g722QM6[wd1]
+		wd1 >>= 2
+
+		// Low band: invert the 6-bit quantizer, reconstruct, then
+		// adapt the scale factor from the top 4 bits.
+		wd2 = (g.band[0].det * wd2) >> 15
+		rlow := g.band[0].s + wd2
+		if rlow > 16383 {
+			rlow = 16383
+		} else if rlow < -16384 {
+			rlow = -16384
+		}
+		wd2 = g722QM4[wd1]
+		dlowt := (g.band[0].det * wd2) >> 15
+		wd2 = g722RL42[wd1]
+		wd1 = (g.band[0].nb * 127) >> 7
+		wd1 += g722WL[wd2]
+		if wd1 < 0 {
+			wd1 = 0
+		} else if wd1 > 18432 {
+			wd1 = 18432
+		}
+		g.band[0].nb = wd1
+		wd1 = (g.band[0].nb >> 6) & 31
+		wd2 = 8 - (g.band[0].nb >> 11)
+		var wd3 int
+		if wd2 < 0 {
+			wd3 = g722ILB[wd1] << uint(-wd2)
+		} else {
+			wd3 = g722ILB[wd1] >> uint(wd2)
+		}
+		g.band[0].det = wd3 << 2
+		g.band[0].update(dlowt)
+
+		// High band: 2-bit quantizer, same adapt/predict structure.
+		wd2 = g722QM2[ihigh]
+		dhigh := (g.band[1].det * wd2) >> 15
+		rhigh := dhigh + g.band[1].s
+		if rhigh > 16383 {
+			rhigh = 16383
+		} else if rhigh < -16384 {
+			rhigh = -16384
+		}
+		wd2 = g722RH2[ihigh]
+		wd1 = (g.band[1].nb * 127) >> 7
+		wd1 += g722WH[wd2]
+		if wd1 < 0 {
+			wd1 = 0
+		} else if wd1 > 22528 {
+			wd1 = 22528
+		}
+		g.band[1].nb = wd1
+		wd1 = (g.band[1].nb >> 6) & 31
+		wd2 = 10 - (g.band[1].nb >> 11)
+		if wd2 < 0 {
+			wd3 = g722ILB[wd1] << uint(-wd2)
+		} else {
+			wd3 = g722ILB[wd1] >> uint(wd2)
+		}
+		g.band[1].det = wd3 << 2
+		g.band[1].update(dhigh)
+
+		// QMF synthesis: recombine the bands into two output samples.
+		copy(g.x[:22], g.x[2:])
+		g.x[22] = rlow + rhigh
+		g.x[23] = rlow - rhigh
+		xout1, xout2 := 0, 0
+		for i := 0; i < 12; i++ {
+			xout2 += g.x[2*i] * g722QMF[i]
+			xout1 += g.x[2*i+1] * g722QMF[11-i]
+		}
+		out = append(out, int16(g722Saturate(xout1>>11)), int16(g722Saturate(xout2>>11)))
+	}
+	return out
+}
+
+// update runs the shared predictor adaptation (ITU block 4) for one
+// band after a sample's difference signal d has been reconstructed.
+func (b *g722Band) update(d int) {
+	b.d[0] = d
+	b.r[0] = g722Saturate(b.s + d)
+	b.p[0] = g722Saturate(b.sz + d)
+
+	// Second-order pole section adaptation.
+	for i := 0; i < 3; i++ {
+		b.sg[i] = b.p[i] >> 15
+	}
+	wd1 := g722Saturate(b.a[1] << 2)
+	wd2 := wd1
+	if b.sg[0] == b.sg[1] {
+		wd2 = -wd1
+	}
+	if wd2 > 32767 {
+		wd2 = 32767
+	}
+	wd3 := -128
+	if b.sg[0] == b.sg[2] {
+		wd3 = 128
+	}
+	wd3 += wd2 >> 7
+	wd3 += (b.a[2] * 32512) >> 15
+	if wd3 > 12288 {
+		wd3 = 12288
+	} else if wd3 < -12288 {
+		wd3 = -12288
+	}
+	b.ap[2] = wd3
+
+	b.sg[0] = b.p[0] >> 15
+	b.sg[1] = b.p[1] >> 15
+	wd1 = -192
+	if b.sg[0] == b.sg[1] {
+		wd1 = 192
+	}
+	wd2 = (b.a[1] * 32640) >> 15
+	b.ap[1] = g722Saturate(wd1 + wd2)
+	wd3 = g722Saturate(15360 - b.ap[2])
+	if b.ap[1] > wd3 {
+		b.ap[1] = wd3
+	} else if b.ap[1] < -wd3 {
+		b.ap[1] = -wd3
+	}
+
+	// Sixth-order zero section adaptation.
+	wd1 = 0
+	if d != 0 {
+		wd1 = 128
+	}
+	b.sg[0] = d >> 15
+	for i := 1; i < 7; i++ {
+		b.sg[i] = b.d[i] >> 15
+		wd2 = -wd1
+		if b.sg[i] == b.sg[0] {
+			wd2 = wd1
+		}
+		wd3 = (b.b[i] * 32640) >> 15
+		b.bp[i] = g722Saturate(wd2 + wd3)
+	}
+
+	// Shift the delay lines.
+	for i := 6; i > 0; i-- {
+		b.d[i] = b.d[i-1]
+		b.b[i] = b.bp[i]
+	}
+	for i := 2; i > 0; i-- {
+		b.r[i] = b.r[i-1]
+		b.p[i] = b.p[i-1]
+		b.a[i] = b.ap[i]
+	}
+
+	// Re-run the predictor filters for the next sample.
+	wd1 = g722Saturate(b.r[1] + b.r[1])
+	wd1 = (b.a[1] * wd1) >> 15
+	wd2 = g722Saturate(b.r[2] + b.r[2])
+	wd2 = (b.a[2] * wd2) >> 15
+	b.sp = g722Saturate(wd1 + wd2)
+	b.sz = 0
+	for i := 6; i > 0; i-- {
+		wd1 = g722Saturate(b.d[i] + b.d[i])
+		b.sz += (b.b[i] * wd1) >> 15
+	}
+	b.sz = g722Saturate(b.sz)
+	b.s = g722Saturate(b.sp + b.sz)
+}
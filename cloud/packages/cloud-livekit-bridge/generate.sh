@@ -0,0 +1,14 @@
+#!/usr/bin/env bash
+# Regenerate Go protobuf/gRPC stubs from proto/livekit_bridge.proto.
+# Requires protoc, protoc-gen-go, protoc-gen-go-grpc on PATH.
+set -euo pipefail
+cd "$(dirname "$0")"
+
+protoc --go_out=. --go_opt=paths=source_relative \
+    --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+    proto/livekit_bridge.proto
+
+# Keep the TypeScript cloud's runtime-loaded copy in sync.
+cp proto/livekit_bridge.proto ../cloud/proto/livekit_bridge.proto
+
+echo "generated proto/livekit_bridge.pb.go + proto/livekit_bridge_grpc.pb.go"
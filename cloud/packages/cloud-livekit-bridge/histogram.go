@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// gapHistogramBuckets is the number of exponential buckets: bucket 0
+// counts gaps under 1ms, bucket i counts gaps in [2^(i-1), 2^i) ms, and
+// the last bucket catches everything longer (≥1.024s with 12 buckets).
+const gapHistogramBuckets = 12
+
+// gapHistogram records inter-arrival gaps for one inbound transport, so
+// burstiness can be quantified and jitter buffers sized from data.
+type gapHistogram struct {
+	mu       sync.Mutex
+	lastAt   time.Time
+	buckets  [gapHistogramBuckets]int64
+	count    int64
+	maxGapMs int64
+}
+
+// observe records an arrival at now.
+func (h *gapHistogram) observe(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.lastAt.IsZero() {
+		gap := now.Sub(h.lastAt).Milliseconds()
+		idx := 0
+		for idx < gapHistogramBuckets-1 && gap >= int64(1)<<idx {
+			idx++
+		}
+		h.buckets[idx]++
+		h.count++
+		if gap > h.maxGapMs {
+			h.maxGapMs = gap
+		}
+	}
+	h.lastAt = now
+}
+
+// proto snapshots the histogram for GetStatus.
+func (h *gapHistogram) proto() *pb.GapHistogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return nil
+	}
+	buckets := make([]int64, gapHistogramBuckets)
+	copy(buckets, h.buckets[:])
+	return &pb.GapHistogram{
+		Buckets:  buckets,
+		Count:    h.count,
+		MaxGapMs: h.maxGapMs,
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// HLS and ICY/Shoutcast ingest for PlayAudio, so internet radio and
+// ambient streams can run as long-lived room audio. HLS playlists are
+// polled and their segments streamed into the ordinary MP3 decode loop
+// as one continuous reader; only MP3 segments are supported (MPEG-TS
+// segments carry AAC, which this binary cannot decode). Playback is
+// indefinite for live playlists and honors StopAudio through the
+// request context like every other source.
+
+// Fallback refresh cadence when the playlist omits TARGETDURATION.
+const hlsDefaultTargetDuration = 6 * time.Second
+
+// playHLS resolves master playlists, wires the segment reader, and
+// hands the byte stream to the MP3 path. Live streams are not cached.
+func (s *LiveKitBridgeService) playHLS(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, playlist []byte, ab *resamplerAB) (int64, error) {
+	base, err := url.Parse(req.AudioUrl)
+	if err != nil {
+		return 0, fmt.Errorf("hls url: %w", err)
+	}
+	// Protected playlists need the caller's auth headers on every
+	// request: variant playlists, refreshes, and segments alike.
+	hdr := s.audioFetchHeaders(req.Headers)
+	text := string(playlist)
+	// Master playlist: follow the first variant (audio streams rarely
+	// have more than one, and we resample anyway).
+	if strings.Contains(text, "#EXT-X-STREAM-INF") {
+		variant := firstPlaylistURI(text)
+		if variant == "" {
+			return 0, fmt.Errorf("hls: master playlist with no variants")
+		}
+		vu, err := base.Parse(variant)
+		if err != nil {
+			return 0, fmt.Errorf("hls variant url: %w", err)
+		}
+		text, err = s.fetchPlaylist(ctx, vu.String(), hdr)
+		if err != nil {
+			return 0, err
+		}
+		base = vu
+	}
+
+	r := newHLSReader(ctx, s.audioHTTP, base, text, hdr)
+	defer r.Close()
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(4); len(head) > 0 && head[0] == 0x47 {
+		return 0, fmt.Errorf("hls: mpeg-ts segments (aac) are not supported; use an mp3-segment playlist")
+	}
+	return s.playMP3(ctx, session, br, req, nil, ab)
+}
+
+func (s *LiveKitBridgeService) fetchPlaylist(ctx context.Context, url string, hdr http.Header) (string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("hls playlist url: %w", err)
+	}
+	setFetchHeaders(httpReq, hdr)
+	resp, err := s.audioHTTP.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("fetch playlist: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch playlist: HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("read playlist: %w", err)
+	}
+	return string(body), nil
+}
+
+// firstPlaylistURI returns the first non-comment line of a playlist.
+func firstPlaylistURI(playlist string) string {
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+// hlsReader turns a media playlist into one continuous byte stream:
+// segments are fetched in order, and live playlists are re-polled at
+// half the target duration until ENDLIST shows up.
+type hlsReader struct {
+	ctx         context.Context
+	client      *http.Client
+	hdr         http.Header
+	base        *url.URL
+	pending     []string
+	seen        map[string]bool
+	cur         io.ReadCloser
+	ended       bool
+	target      time.Duration
+	lastRefresh time.Time
+}
+
+func newHLSReader(ctx context.Context, client *http.Client, base *url.URL, playlist string, hdr http.Header) *hlsReader {
+	h := &hlsReader{
+		ctx:    ctx,
+		client: client,
+		hdr:    hdr,
+		base:   base,
+		seen:   make(map[string]bool),
+		target: hlsDefaultTargetDuration,
+	}
+	h.ingest(playlist)
+	h.lastRefresh = time.Now()
+	return h
+}
+
+// ingest appends unseen segment URIs and picks up playlist directives.
+func (h *hlsReader) ingest(playlist string) {
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if v, ok := strings.CutPrefix(line, "#EXT-X-TARGETDURATION:"); ok {
+				if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+					h.target = time.Duration(n) * time.Second
+				}
+			}
+			if line == "#EXT-X-ENDLIST" {
+				h.ended = true
+			}
+			continue
+		}
+		if !h.seen[line] {
+			h.seen[line] = true
+			h.pending = append(h.pending, line)
+		}
+	}
+}
+
+func (h *hlsReader) Read(p []byte) (int, error) {
+	for {
+		if err := h.ctx.Err(); err != nil {
+			return 0, err
+		}
+		if h.cur != nil {
+			n, err := h.cur.Read(p)
+			if n > 0 {
+				return n, nil
+			}
+			h.cur.Close()
+			h.cur = nil
+			if err != nil && err != io.EOF {
+				// A torn segment is a blip, not the end of the station.
+				log.Printf("hls segment read: %v (continuing)", err)
+			}
+			continue
+		}
+		if len(h.pending) == 0 {
+			if h.ended {
+				return 0, io.EOF
+			}
+			if wait := h.target/2 - time.Since(h.lastRefresh); wait > 0 {
+				select {
+				case <-h.ctx.Done():
+					return 0, h.ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			if err := h.refresh(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		uri := h.pending[0]
+		h.pending = h.pending[1:]
+		seg, err := h.fetchSegment(uri)
+		if err != nil {
+			return 0, err
+		}
+		h.cur = seg
+	}
+}
+
+func (h *hlsReader) refresh() error {
+	httpReq, err := http.NewRequestWithContext(h.ctx, http.MethodGet, h.base.String(), nil)
+	if err != nil {
+		return err
+	}
+	setFetchHeaders(httpReq, h.hdr)
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("refresh playlist: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("refresh playlist: HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("refresh playlist: %w", err)
+	}
+	h.ingest(string(body))
+	h.lastRefresh = time.Now()
+	return nil
+}
+
+func (h *hlsReader) fetchSegment(uri string) (io.ReadCloser, error) {
+	u, err := h.base.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("hls segment url %q: %w", uri, err)
+	}
+	httpReq, err := http.NewRequestWithContext(h.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	setFetchHeaders(httpReq, h.hdr)
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("fetch segment: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch segment: HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (h *hlsReader) Close() error {
+	if h.cur != nil {
+		h.cur.Close()
+		h.cur = nil
+	}
+	return nil
+}
+
+// icyReader strips ICY/Shoutcast inline metadata: metaint audio bytes,
+// then a length byte and length*16 bytes of "StreamTitle=..." text,
+// repeating. Without stripping, the metadata corrupts the MP3 frames.
+type icyReader struct {
+	r       io.Reader
+	metaint int
+	left    int
+}
+
+func newICYReader(r io.Reader, metaint int) *icyReader {
+	return &icyReader{r: r, metaint: metaint, left: metaint}
+}
+
+func (i *icyReader) Read(p []byte) (int, error) {
+	if i.left == 0 {
+		var lenByte [1]byte
+		if _, err := io.ReadFull(i.r, lenByte[:]); err != nil {
+			return 0, err
+		}
+		if n := int64(lenByte[0]) * 16; n > 0 {
+			if _, err := io.CopyN(io.Discard, i.r, n); err != nil {
+				return 0, err
+			}
+		}
+		i.left = i.metaint
+	}
+	if len(p) > i.left {
+		p = p[:i.left]
+	}
+	n, err := i.r.Read(p)
+	i.left -= n
+	return n, err
+}
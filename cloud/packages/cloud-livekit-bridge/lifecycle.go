@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Ordered shutdown. Subsystems register a stop hook as they start, and
+// stopAll runs the hooks in reverse registration order — dependents
+// before dependencies: the gRPC server drains before sessions close,
+// sessions close before the UDP listener that feeds them. Each hook
+// runs under a watchdog so one wedged subsystem can't hang process
+// exit, and the whole sequence runs exactly once no matter how many
+// paths (signal handler, Serve returning) trigger it.
+const lifecycleHookTimeout = 15 * time.Second
+
+type lifecycleHook struct {
+	name string
+	stop func()
+}
+
+type lifecycle struct {
+	mu    sync.Mutex
+	hooks []lifecycleHook
+	once  sync.Once
+}
+
+func newLifecycle() *lifecycle { return &lifecycle{} }
+
+// onStop registers a shutdown hook. Register in startup order; stopAll
+// runs newest first.
+func (l *lifecycle) onStop(name string, stop func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, lifecycleHook{name: name, stop: stop})
+}
+
+// stopAll runs every registered hook once, newest first, logging each
+// stage so a hang is attributable. Concurrent callers block until the
+// first caller's sequence finishes.
+func (l *lifecycle) stopAll() {
+	l.once.Do(func() {
+		l.mu.Lock()
+		hooks := make([]lifecycleHook, len(l.hooks))
+		copy(hooks, l.hooks)
+		l.mu.Unlock()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			h := hooks[i]
+			log.Printf("shutdown: stopping %s", h.name)
+			done := make(chan struct{})
+			go func() {
+				h.stop()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(lifecycleHookTimeout):
+				log.Printf("shutdown: %s did not stop within %s, continuing", h.name, lifecycleHookTimeout)
+			}
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+// prewarmLiveKitHost keeps the dial path to the configured LiveKit host
+// warm: on an interval it resolves the host and completes a TLS
+// handshake, then drops the connection. The SDK dials its own websocket
+// per join, so this cannot hand it a standby connection — what it
+// removes is the cold part of that dial: the resolver answer, the load
+// balancer path, and any NAT state along the way, which is where most
+// of a first join's ~1s goes after a deploy or an idle period. The
+// measured handshake time is logged so drift is visible; the per-join
+// figure is in JoinRoomResponse.join_latency_ms.
+func prewarmLiveKitHost(rawURL string, interval time.Duration) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		log.Printf("livekit prewarm: bad url %q: %v", rawURL, err)
+		return
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	addr := net.JoinHostPort(host, port)
+
+	warm := func() {
+		start := time.Now()
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+		if err != nil {
+			log.Printf("livekit prewarm %s: %v", addr, err)
+			return
+		}
+		conn.Close()
+		log.Printf("livekit prewarm %s: handshake %dms", addr, time.Since(start).Milliseconds())
+	}
+
+	warm()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			warm()
+		}
+	}()
+}
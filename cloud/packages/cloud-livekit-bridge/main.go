@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// livekit-bridge: gRPC bridge between the TypeScript cloud and LiveKit.
+//
+// Control plane: unary RPCs (JoinRoom, LeaveRoom, PlayAudio, StopAudio).
+// Data plane: one bidirectional StreamAudio stream per user, plus an
+// optional UDP uplink listener for lowest-latency phone audio.
+
+func main() {
+	// Load .env if present (ignore error to allow clean env-only usage)
+	_ = godotenv.Load()
+	if err := run(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+func run() error {
+	config := LoadConfig()
+
+	// The playback rate is instance-global (tracks, DSP and envelope
+	// math all key off it), so pin it before the self-test or any
+	// session runs.
+	if config.PlaybackSampleRate < 8000 || config.PlaybackSampleRate > 48000 {
+		log.Printf("BRIDGE_PLAYBACK_SAMPLE_RATE %d out of range [8000, 48000], keeping %d", config.PlaybackSampleRate, playbackSampleRate)
+	} else {
+		playbackSampleRate = config.PlaybackSampleRate
+	}
+
+	// Catch broken builds before traffic arrives: refuse to come up when
+	// the audio pipeline or UDP path doesn't behave.
+	if config.SelfTest {
+		if err := runSelfTest(config); err != nil {
+			return fmt.Errorf("selftest failed, refusing to start: %w", err)
+		}
+	}
+
+	service := NewLiveKitBridgeService(config)
+
+	// Stop hooks run in reverse registration order: gRPC drains first,
+	// then sessions close, then the UDP listener that feeds them stops.
+	lc := newLifecycle()
+	defer lc.stopAll()
+
+	if config.UDPPort > 0 {
+		udp := NewUdpAudioListener(service, config.UDPPort)
+		if err := udp.Start(); err != nil {
+			return fmt.Errorf("start udp listener: %w", err)
+		}
+		service.udp = udp
+		lc.onStop("udp listener", udp.Stop)
+	}
+
+	lc.onStop("sessions", service.CloseAll)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GRPCPort))
+	if err != nil {
+		return fmt.Errorf("listen :%d: %w", config.GRPCPort, err)
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(service.panicUnaryInterceptor, service.tenantUnaryInterceptor, service.affinityUnaryInterceptor, service.auditUnaryInterceptor),
+		grpc.ChainStreamInterceptor(service.panicStreamInterceptor, service.tenantStreamInterceptor, service.affinityStreamInterceptor, service.auditStreamInterceptor),
+	)
+	pb.RegisterLiveKitBridgeServer(server, service)
+
+	lc.onStop("grpc server", func() {
+		// Drain; long-lived streams are cut at the deadline.
+		hardStop := time.AfterFunc(config.DrainTimeout, server.Stop)
+		server.GracefulStop()
+		hardStop.Stop()
+	})
+
+	if config.AdminPort > 0 {
+		if config.AdminToken == "" {
+			log.Printf("BRIDGE_ADMIN_PORT set but BRIDGE_ADMIN_TOKEN empty; admin ui disabled")
+		} else {
+			admin := newAdminServer(service, config.AdminPort, config.AdminToken)
+			admin.Start()
+			lc.onStop("admin ui", admin.Stop)
+		}
+	}
+
+	// Graceful shutdown on SIGINT/SIGTERM.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		log.Printf("received %v, shutting down", sig)
+		// Tell event subscribers first so the cloud can migrate users,
+		// then stop subsystems in dependency order.
+		service.AnnounceShutdown(time.Now().Add(config.DrainTimeout))
+		lc.stopAll()
+	}()
+
+	log.Printf("livekit-bridge %s listening on :%d (udp=%d)", serverVersion, config.GRPCPort, config.UDPPort)
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("grpc serve: %w", err)
+	}
+
+	// Serve returned via the grpc hook; run (or wait out) the rest of
+	// the shutdown chain before declaring completion.
+	lc.stopAll()
+	log.Printf("shutdown complete")
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// stereoMixer renders two bridged senders into the left/right channels of
+// a stereo inbound stream (JoinRoomRequest.stereo_mixdown). Each frame is
+// panned hard to its sender's channel with silence on the other, which is
+// all a diarizing ASR needs to separate the speakers. Frames from a third
+// or later sender pass through unchanged (mono).
+type stereoMixer struct {
+	mu       sync.Mutex
+	channels map[string]int // senderIdentity → 0 (left) / 1 (right)
+}
+
+func newStereoMixer() *stereoMixer {
+	return &stereoMixer{channels: make(map[string]int)}
+}
+
+// render returns a stereo version of frame panned to its sender's channel,
+// or the original frame if both channels are already taken by others.
+func (m *stereoMixer) render(frame *inboundFrame) *inboundFrame {
+	m.mu.Lock()
+	ch, ok := m.channels[frame.senderIdentity]
+	if !ok {
+		if len(m.channels) >= 2 {
+			m.mu.Unlock()
+			return frame
+		}
+		ch = len(m.channels)
+		m.channels[frame.senderIdentity] = ch
+		side := "left"
+		if ch == 1 {
+			side = "right"
+		}
+		log.Printf("stereo mixdown: sender %s → %s channel", frame.senderIdentity, side)
+	}
+	m.mu.Unlock()
+
+	mono := frame.pcm
+	stereo := make([]byte, len(mono)*2)
+	for i := 0; i+1 < len(mono); i += 2 {
+		// Interleaved L/R, sample on the sender's channel.
+		stereo[i*2+ch*2] = mono[i]
+		stereo[i*2+ch*2+1] = mono[i+1]
+	}
+	return &inboundFrame{
+		pcm:            stereo,
+		senderIdentity: frame.senderIdentity,
+		trackName:      frame.trackName,
+		channels:       2,
+	}
+}
@@ -0,0 +1,1825 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mp3 "github.com/hajimehoshi/go-mp3"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// playbackSampleRate is the rate everything decodes and publishes at.
+// 16kHz matches the glasses audio path, but rooms negotiating full-band
+// Opus can run higher via Config.PlaybackSampleRate; it is fixed once
+// at startup, before any session or track exists.
+var playbackSampleRate = 16000
+
+// Playback is always mono (matches the glasses audio path).
+const playbackChannels = 1
+
+// ErrPlaybackStalled is returned when a track's internal buffer stops
+// draining (peer gone, renegotiation stuck) and a WriteSample call makes
+// no progress within the configured timeout.
+var ErrPlaybackStalled = errors.New("playback stalled: track buffer not draining")
+
+// ErrPlaybackTimeout is returned when a clip with a known duration runs
+// far past its expected completion time (upstream trickling bytes or
+// wedged), instead of hanging the PlayAudio stream indefinitely.
+var ErrPlaybackTimeout = errors.New("playback ran past its expected duration")
+
+// FAILED event codes for clips over the configured fetch caps.
+const (
+	capCodeTooLarge = "AUDIO_TOO_LARGE"
+	capCodeTooLong  = "AUDIO_TOO_LONG"
+)
+
+// audioCapError reports a fetched clip exceeding the configured size or
+// duration cap. Typed so finishPlayback can attach the specific code:
+// a capped clip is the caller's problem, not a broken bridge.
+type audioCapError struct {
+	code  string // capCodeTooLarge or capCodeTooLong
+	limit string // the cap that was hit, e.g. "50 MB" or "600s"
+}
+
+func (e *audioCapError) Error() string {
+	return fmt.Sprintf("audio exceeds the configured %s cap", e.limit)
+}
+
+// startLatencyCode is the FAILED event code for playbacks aborted by
+// their max_start_latency_ms budget.
+const startLatencyCode = "START_LATENCY_EXCEEDED"
+
+// startLatencyError reports a playback whose first samples did not
+// reach the track within the caller's budget. Typed so finishPlayback
+// can attach the code the cloud keys its on-device TTS fallback on.
+type startLatencyError struct {
+	budget time.Duration
+}
+
+func (e *startLatencyError) Error() string {
+	return fmt.Sprintf("playback did not start within its %v latency budget", e.budget)
+}
+
+// cappedReader fails a download once more than max bytes have been
+// read, so a mispointed URL (a video, an endless stream) can't tie up
+// the track and its decode goroutine.
+type cappedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return n, &audioCapError{code: capCodeTooLarge, limit: fmt.Sprintf("%d MB", c.max>>20)}
+	}
+	return n, err
+}
+
+// declickMs is the built-in anti-click ramp at clip boundaries: a hard
+// sample boundary at the start or end of a clip (or after a seek)
+// clicks on the glasses speaker, so every clip ramps in and out over
+// this window unless a caller fade already covers the boundary.
+const declickMs = 3
+
+// declickGain is the raised-cosine ramp value at pos of n samples
+// (0 = silence, n = unity). Smoother at the endpoints than the linear
+// caller fades, which matters at these very short lengths.
+func declickGain(pos, n int64) float64 {
+	return 0.5 * (1 - math.Cos(math.Pi*float64(pos)/float64(n)))
+}
+
+// stopFadeDuration is the anti-click ramp StopAudio applies before the
+// playback context is actually cancelled. A hard cut mid-waveform
+// produces an audible click on the glasses speaker.
+const stopFadeDuration = 120 * time.Millisecond
+
+// applyStopFade ramps a block toward silence based on how far into the
+// stop fade each sample falls. channels keeps the ramp clock honest for
+// interleaved stereo blocks.
+func applyStopFade(samples []int16, channels int, elapsed, total time.Duration) {
+	for i := range samples {
+		at := elapsed + time.Duration(i/channels)*time.Second/time.Duration(playbackSampleRate)
+		if at >= total {
+			samples[i] = 0
+			continue
+		}
+		samples[i] = int16(float64(samples[i]) * float64(total-at) / float64(total))
+	}
+}
+
+// playbackDeadline turns a clip's expected duration into an abort
+// deadline: double the content length plus fixed slack, so slow CDNs
+// and cold caches don't trip it but a wedged source does.
+// Zero expected duration (unknown) means no deadline.
+func playbackDeadline(expectedMs int64) time.Time {
+	if expectedMs <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(2*time.Duration(expectedMs)*time.Millisecond + 10*time.Second)
+}
+
+// trackWriter wraps WriteSample with a stall watchdog. WriteSample can
+// block (or silently accept data) forever when the track stops draining;
+// the watchdog fails the write after PlaybackWriteTimeout and unpublishes
+// the track so the next playback starts on a fresh one.
+type trackWriter struct {
+	session   *RoomSession
+	trackID   int32
+	requestID string
+	timeout   time.Duration
+	chain     dspChain
+	bed       *bedMixer
+	rate      float64
+
+	// Fade envelopes (samples at 16kHz). The fade-out holds back the
+	// last fadeOut samples in tail until finish() ramps them down.
+	fadeIn  int
+	fadeOut int
+	written int64
+	tail    []int16
+
+	// Boundary de-click ramps, set only when the corresponding caller
+	// fade is absent (a fade already covers that boundary).
+	declickIn  int
+	declickOut int
+
+	// Decoded-duration cap in samples (0 = unbounded; live RTSP/RTP
+	// sources are exempt). Applies per clip: loop iterations each get
+	// their own writer.
+	maxSamples int64
+
+	// Pacing: decode may run at most `lead` ahead of real time, so the
+	// SDK never holds more than that much queued audio. epoch is set on
+	// the first emit; emitted counts samples actually handed to the
+	// track.
+	lead    time.Duration
+	epoch   time.Time
+	emitted int64
+
+	// Whether this writer has told the session its first samples landed
+	// (releases the start-latency watchdog).
+	notedStart bool
+
+	// Expected clip duration for PROGRESS events, set by decoders that
+	// can work it out (0 = unknown), already adjusted for playback rate.
+	expectedMs int64
+
+	// Requested track publish rate (0 = playback rate); the internal
+	// pipeline always runs at playbackSampleRate and emit resamples at
+	// the track boundary.
+	outRate int
+
+	// Silence trim (trim_silence_ms): the leading budget counts down as
+	// quiet frames are dropped; the quiet run at the current end of the
+	// stream is held back in trimHeld and either flushed when audio
+	// resumes (mid-clip silence is never trimmed) or dropped by finish().
+	trimThreshold int16
+	trimLeadLeft  int
+	trimTrailMax  int
+	trimHeld      []int16
+
+	// Channel count of the samples flowing through this writer (1 or
+	// 2, interleaved). Envelope lengths and counters are in samples;
+	// anything measured in time divides by this. chainR is the right
+	// channel's own DSP chain instance for stereo (stateful stages must
+	// not share filter state across channels).
+	channels int
+	chainR   dspChain
+}
+
+func (s *LiveKitBridgeService) newTrackWriter(session *RoomSession, req *pb.PlayAudioRequest) *trackWriter {
+	fadeIn := req.FadeInMs
+	if fadeIn == 0 {
+		// A crossfading request ramps in over the same window the
+		// preempted audio ramps out.
+		fadeIn = req.CrossfadeMs
+	}
+	channels := int(req.OutputChannels)
+	if channels == 0 {
+		channels = 1
+	}
+	var maxSamples int64
+	if s.config.AudioMaxDuration > 0 && !isLiveSource(req.AudioUrl) {
+		maxSamples = int64(s.config.AudioMaxDuration.Seconds()*float64(playbackSampleRate)) * int64(channels)
+	}
+	w := &trackWriter{
+		session:    session,
+		trackID:    req.TrackId,
+		requestID:  req.RequestId,
+		timeout:    s.config.PlaybackWriteTimeout,
+		chain:      s.dspChainFor(req),
+		bed:        s.bedFor(req.RequestId),
+		rate:       playbackRate(req),
+		fadeIn:     int(fadeIn) * playbackSampleRate / 1000 * channels,
+		fadeOut:    int(req.FadeOutMs) * playbackSampleRate / 1000 * channels,
+		maxSamples: maxSamples,
+		lead:       s.config.PlaybackLeadBudget,
+		outRate:    int(req.TrackSampleRate),
+		channels:   channels,
+	}
+	if channels == 2 {
+		w.chainR = s.dspChainFor(req)
+	}
+	if req.TrimSilenceMs > 0 {
+		thr := float64(req.TrimSilenceThreshold)
+		if thr == 0 {
+			thr = defaultTrimThreshold
+		}
+		w.trimThreshold = int16(thr * 32767)
+		w.trimLeadLeft = int(req.TrimSilenceMs) * playbackSampleRate / 1000 * channels
+		w.trimTrailMax = w.trimLeadLeft
+	}
+	declick := declickMs * playbackSampleRate / 1000 * channels
+	if w.fadeIn == 0 {
+		w.declickIn = declick
+	}
+	if w.fadeOut == 0 {
+		w.declickOut = declick
+	}
+	return w
+}
+
+// crossfadeSink hands a track between playbacks without a hard cut:
+// when a new request preempts with crossfade_ms set, the outgoing
+// writer ramps its remaining audio down into the sink instead of the
+// track, and the incoming writer mixes it back under its own ramped-up
+// audio, bed-style.
+type crossfadeSink struct {
+	mu     sync.Mutex
+	from   string // outgoing request ID; only its writer fills
+	total  int    // ramp length in samples
+	ramped int
+	buf    []int16
+}
+
+// fill down-ramps an outgoing block into the sink. Blocks past the end
+// of the ramp are dropped (the outgoing decode is cancelled shortly
+// after anyway).
+func (x *crossfadeSink) fill(samples []int16) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, s := range samples {
+		if x.ramped >= x.total {
+			return
+		}
+		x.buf = append(x.buf, int16(float64(s)*float64(x.total-x.ramped)/float64(x.total)))
+		x.ramped++
+	}
+}
+
+// drain mixes captured outgoing audio under an incoming block, clipping
+// at the rails. Reports whether the sink is spent.
+func (x *crossfadeSink) drain(samples []int16) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	n := len(samples)
+	if n > len(x.buf) {
+		n = len(x.buf)
+	}
+	for i := 0; i < n; i++ {
+		v := int(samples[i]) + int(x.buf[i])
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		samples[i] = int16(v)
+	}
+	x.buf = x.buf[n:]
+	return len(x.buf) == 0 && x.ramped >= x.total
+}
+
+// playbackRate normalizes PlayAudioRequest.playback_rate (0 = 1.0).
+func playbackRate(req *pb.PlayAudioRequest) float64 {
+	if req.PlaybackRate == 0 {
+		return 1
+	}
+	return float64(req.PlaybackRate)
+}
+
+// dspChainFor builds the playback chain for a request: the track's
+// configured override if there is one, else the global chain, with the
+// request volume baked into the gain stage. Specs are validated at
+// startup, so a build failure here means a factory regressed; fall back
+// to the default chain rather than playing unprocessed audio.
+func (s *LiveKitBridgeService) dspChainFor(req *pb.PlayAudioRequest) dspChain {
+	specs := s.config.DSPChain
+	if override, ok := s.config.DSPTrackChains[req.TrackId]; ok {
+		specs = override
+	}
+	volume := float64(volumeOrDefault(req.Volume))
+	chain, err := newDSPChain(specs, volume)
+	if err != nil {
+		log.Printf("dsp chain for track %d: %v (using default)", req.TrackId, err)
+		chain, _ = newDSPChain(nil, volume)
+	}
+	return chain
+}
+
+func (w *trackWriter) write(samples []int16) error {
+	// Hold here while the track is paused. Stop/preempt closes the gate
+	// too, and the caller's next ctx check exits the loop.
+	if gate := w.session.pauseGate(w.trackID); gate != nil {
+		<-gate
+	}
+	start := time.Now()
+	// Time-stretch by resampling: treat the block as if it were at
+	// rate×16kHz and bring it back to 16kHz. Pitch shifts with the
+	// rate, which is acceptable for sped-up TTS.
+	if w.rate != 1 {
+		samples = resampleInterleaved(samples, w.channels, int(float64(playbackSampleRate)*w.rate), playbackSampleRate)
+	}
+	// Silence trim runs before the fades, so a fade-in ramps the first
+	// audible samples rather than the dropped silence.
+	if w.trimLeadLeft > 0 {
+		samples = w.trimLead(samples)
+	}
+	if w.trimTrailMax > 0 {
+		samples = w.trimTrail(samples)
+	}
+	if w.trimThreshold > 0 && len(samples) == 0 {
+		w.session.chargeDecode(start)
+		return nil
+	}
+	if w.fadeIn > 0 && w.written < int64(w.fadeIn) {
+		for i := range samples {
+			pos := w.written + int64(i)
+			if pos >= int64(w.fadeIn) {
+				break
+			}
+			samples[i] = int16(float64(samples[i]) * float64(pos) / float64(w.fadeIn))
+		}
+	}
+	if w.declickIn > 0 && w.written < int64(w.declickIn) {
+		for i := range samples {
+			pos := w.written + int64(i)
+			if pos >= int64(w.declickIn) {
+				break
+			}
+			samples[i] = int16(float64(samples[i]) * declickGain(pos, int64(w.declickIn)))
+		}
+	}
+	w.written += int64(len(samples))
+	if w.maxSamples > 0 && w.written > w.maxSamples {
+		w.session.chargeDecode(start)
+		return &audioCapError{
+			code:  capCodeTooLong,
+			limit: fmt.Sprintf("%ds", w.maxSamples/int64(playbackSampleRate*w.channels)),
+		}
+	}
+	// Anti-click stop: StopAudio starts a short ramp and cancels the
+	// playback only after it has run out.
+	if start, ok := w.session.stopFadeStart(w.trackID); ok {
+		applyStopFade(samples, w.channels, time.Since(start), stopFadeDuration)
+	}
+	if hold := w.tailHold(); hold > 0 {
+		// Hold back the end-of-clip ramp window; only what precedes it
+		// plays now.
+		w.tail = append(w.tail, samples...)
+		if len(w.tail) <= hold {
+			w.session.chargeDecode(start)
+			return nil
+		}
+		samples = w.tail[:len(w.tail)-hold]
+		w.tail = append([]int16(nil), w.tail[len(w.tail)-hold:]...)
+	}
+	w.session.chargeDecode(start)
+	return w.emit(samples)
+}
+
+// defaultTrimThreshold is the silence-trim amplitude when the request
+// leaves trim_silence_threshold unset: 1% of full scale (≈ -40 dBFS),
+// low enough to keep TTS breath noise, high enough to catch encoder
+// padding and room-tone leaders.
+const defaultTrimThreshold = 0.01
+
+// trimFrameLoud reports whether any channel of a frame is above the
+// trim threshold.
+func (w *trackWriter) trimFrameLoud(frame []int16) bool {
+	for _, v := range frame {
+		if v > w.trimThreshold || v < -w.trimThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// trimLead drops quiet frames from the front of the clip until audio
+// appears or the budget runs out; either way the trim is then done for
+// the rest of the clip.
+func (w *trackWriter) trimLead(samples []int16) []int16 {
+	i := 0
+	for i+w.channels <= len(samples) && w.trimLeadLeft > 0 {
+		if w.trimFrameLoud(samples[i : i+w.channels]) {
+			w.trimLeadLeft = 0
+			break
+		}
+		i += w.channels
+		w.trimLeadLeft -= w.channels
+	}
+	return samples[i:]
+}
+
+// trimTrail holds back the quiet run at the current end of the stream.
+// When audio resumes, the held frames flush ahead of it — mid-clip
+// silence plays untouched; only a run still held at finish() is
+// trimmed. The hold is capped at the trim budget: anything quieter for
+// longer plays normally from the front of the run.
+func (w *trackWriter) trimTrail(samples []int16) []int16 {
+	last := -1
+	for i := len(samples) - w.channels; i >= 0; i -= w.channels {
+		if w.trimFrameLoud(samples[i : i+w.channels]) {
+			last = i + w.channels
+			break
+		}
+	}
+	if last >= 0 {
+		out := append(w.trimHeld, samples[:last]...)
+		w.trimHeld = append([]int16(nil), samples[last:]...)
+		return out
+	}
+	w.trimHeld = append(w.trimHeld, samples...)
+	if excess := len(w.trimHeld) - w.trimTrailMax; excess > 0 {
+		out := w.trimHeld[:excess]
+		w.trimHeld = append([]int16(nil), w.trimHeld[excess:]...)
+		return out
+	}
+	return nil
+}
+
+// tailHold is how much audio the writer holds back for the end-of-clip
+// ramp: the caller's fade-out, else the built-in de-click window.
+func (w *trackWriter) tailHold() int {
+	if w.fadeOut > 0 {
+		return w.fadeOut
+	}
+	return w.declickOut
+}
+
+// finish ramps the held-back tail to silence and writes it. Call after
+// the last write of a clip that decoded to completion; on error or
+// cancel the tail is simply dropped.
+func (w *trackWriter) finish() error {
+	// The quiet run held back at the end of the stream is the trailing
+	// silence: dropping it here is the trim.
+	w.trimHeld = nil
+	if w.tailHold() == 0 || len(w.tail) == 0 {
+		return nil
+	}
+	out := w.tail
+	w.tail = nil
+	n := len(out)
+	for i := range out {
+		if w.fadeOut > 0 {
+			out[i] = int16(float64(out[i]) * float64(n-1-i) / float64(n))
+		} else {
+			out[i] = int16(float64(out[i]) * declickGain(int64(n-1-i), int64(n)))
+		}
+	}
+	return w.emit(out)
+}
+
+// pace sleeps until the track's queued audio is back under the lead
+// budget, so decode never runs far ahead of real time: StopAudio takes
+// effect promptly and long files don't pile up in the SDK's buffer.
+// After a pause the clock has kept running, so the writer bursts until
+// the lead is rebuilt — exactly what an empty buffer needs.
+//
+// The computed depth is also sampled into the session (even with pacing
+// disabled), so GetStatus can show whether laggy playback is buffered
+// bridge-side or further down the path.
+func (w *trackWriter) pace(n int) {
+	if w.epoch.IsZero() {
+		w.epoch = time.Now()
+	}
+	queued := time.Duration(w.emitted/int64(w.channels))*time.Second/time.Duration(playbackSampleRate) - time.Since(w.epoch)
+	if queued < 0 {
+		queued = 0
+	}
+	w.session.noteTrackLead(w.trackID, queued)
+	w.session.notePlaybackProgress(w.trackID, w.requestID, int64(n/w.channels), w.expectedMs)
+	atomic.AddInt64(&w.session.samplesPlayed, int64(n/w.channels))
+	if w.lead > 0 && queued > w.lead {
+		time.Sleep(queued - w.lead)
+	}
+	w.emitted += int64(n)
+}
+
+// emit runs the post-envelope pipeline: DSP chain, bed mix, crossfade
+// handoff, output profile, RTP mirror, and the watchdogged WriteSample.
+func (w *trackWriter) emit(samples []int16) error {
+	start := time.Now()
+	if w.channels == 2 {
+		// Each channel gets its own chain instance so stateful stages
+		// (eq, loudnorm) don't smear filter state across L and R.
+		left, right := splitStereo(samples)
+		w.chain.process(left)
+		w.chainR.process(right)
+		interleaveStereo(samples, left, right)
+	} else {
+		w.chain.process(samples)
+	}
+	if w.bed != nil {
+		w.bed.mix(samples)
+	}
+	if x := w.session.crossfadeFor(w.trackID); x != nil {
+		if x.from == w.requestID {
+			// This playback was preempted with a crossfade: its audio
+			// feeds the sink now, never the track.
+			x.fill(samples)
+			w.session.chargeDecode(start)
+			return nil
+		}
+		if x.drain(samples) {
+			w.session.clearCrossfade(w.trackID, x)
+		}
+	}
+	// Live track gain (SetTrackVolume) applies to everything on the
+	// track, bed and crossfaded tails included.
+	if g := w.session.trackGain(w.trackID); g != 1 {
+		applyGain(samples, g)
+	}
+	if p := w.session.outputProfile.Load(); p != nil {
+		p.apply(samples)
+	}
+	// The RTP mirror is mono narrowband; stereo is downmixed for it.
+	if w.channels == 2 {
+		w.session.mirrorToRTP(w.trackID, downmixToMono(samples, 2))
+	} else {
+		w.session.mirrorToRTP(w.trackID, samples)
+	}
+	// Time attributed so far is pure processing; the pacing sleep and
+	// WriteSample wait below are not work, and deliberately excluded.
+	w.session.chargeDecode(start)
+	w.pace(len(samples))
+	track, tf, err := w.session.getOrCreateTrack(w.trackID, trackFormat{rate: w.outRate, channels: w.channels})
+	if err != nil {
+		return err
+	}
+	// The writer's samples are converted to the track's published
+	// format here, last: a track that predates this request keeps the
+	// rate and channel count it was published with.
+	if w.channels != tf.channels {
+		if tf.channels == 2 {
+			samples = monoToStereo(samples)
+		} else {
+			samples = downmixToMono(samples, w.channels)
+		}
+	}
+	if tf.rate != playbackSampleRate {
+		samples = resampleInterleaved(samples, tf.channels, playbackSampleRate, tf.rate)
+	}
+	done := make(chan error, 1)
+	go func() { done <- track.WriteSample(samples) }()
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err == nil && !w.notedStart {
+			w.notedStart = true
+			w.session.noteFirstWrite(w.trackID, w.requestID)
+		}
+		return err
+	case <-timer.C:
+		// Closing the track unblocks the stuck writer goroutine.
+		log.Printf("write watchdog fired for user %s track '%s', recreating track",
+			w.session.userID, trackName(w.trackID))
+		w.session.recordError("track", "write watchdog fired on track '%s'", trackName(w.trackID))
+		w.session.removeTrack(w.trackID)
+		return ErrPlaybackStalled
+	}
+}
+
+// validatePlayRequest checks a PlayAudioRequest's fields and option
+// combinations; shared between PlayAudio and EnqueueAudio.
+func validatePlayRequest(req *pb.PlayAudioRequest) error {
+	if req.AudioUrl == "" && len(req.Items) == 0 {
+		return status.Errorf(codes.InvalidArgument, "audio_url or items required")
+	}
+	return validatePlayParams(req)
+}
+
+// validatePlayParams checks everything except the audio source itself,
+// so PlayAudioData (whose bytes ride the RPC, no URL) shares the same
+// rules for volume, fades, DSP, trim, and track options.
+func validatePlayParams(req *pb.PlayAudioRequest) error {
+	if req.UserId == "" {
+		return status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	for i, item := range req.Items {
+		if item.AudioUrl == "" {
+			return status.Errorf(codes.InvalidArgument, "items[%d].audio_url required", i)
+		}
+	}
+	if req.SampleRate != 0 && (req.SampleRate < 8000 || req.SampleRate > 48000) {
+		return status.Errorf(codes.InvalidArgument, "sample_rate %d out of range [8000, 48000]", req.SampleRate)
+	}
+	if req.TrackSampleRate != 0 && (req.TrackSampleRate < 8000 || req.TrackSampleRate > 48000) {
+		return status.Errorf(codes.InvalidArgument, "track_sample_rate %d out of range [8000, 48000]", req.TrackSampleRate)
+	}
+	if req.OutputChannels != 0 && req.OutputChannels != 1 && req.OutputChannels != 2 {
+		return status.Errorf(codes.InvalidArgument, "output_channels must be 1 or 2")
+	}
+	if req.OutputChannels == 2 {
+		// The bed, crossfade, loop, and live paths all run through the
+		// mono decode cache; rejecting the combination beats silently
+		// downmixing what the caller asked to keep.
+		switch {
+		case req.BackgroundUrl != "":
+			return status.Errorf(codes.InvalidArgument, "output_channels=2 cannot be combined with background_url")
+		case req.CrossfadeMs > 0:
+			return status.Errorf(codes.InvalidArgument, "output_channels=2 cannot be combined with crossfade_ms")
+		case req.LoopCount > 1 || req.LoopForever:
+			return status.Errorf(codes.InvalidArgument, "output_channels=2 cannot be combined with loops")
+		case isLiveSource(req.AudioUrl):
+			return status.Errorf(codes.InvalidArgument, "output_channels=2 is not supported for live rtsp/rtp sources")
+		}
+	}
+	if req.Channels < 0 || req.Channels > 2 {
+		return status.Errorf(codes.InvalidArgument, "channels must be 1 or 2")
+	}
+	if req.BitsPerSample != 0 && req.BitsPerSample != 16 {
+		return status.Errorf(codes.InvalidArgument, "bits_per_sample %d unsupported (16-bit little-endian only)", req.BitsPerSample)
+	}
+	if req.LoopCount < 0 {
+		return status.Errorf(codes.InvalidArgument, "loop_count must be >= 0")
+	}
+	if req.StartOffsetMs < 0 {
+		return status.Errorf(codes.InvalidArgument, "start_offset_ms must be >= 0")
+	}
+	if req.PlaybackRate != 0 && (req.PlaybackRate < 0.5 || req.PlaybackRate > 2.0) {
+		return status.Errorf(codes.InvalidArgument, "playback_rate %.2f out of range [0.5, 2.0]", req.PlaybackRate)
+	}
+	if req.FadeInMs < 0 || req.FadeOutMs < 0 {
+		return status.Errorf(codes.InvalidArgument, "fade durations must be >= 0")
+	}
+	if req.FadeInMs > 10000 || req.FadeOutMs > 10000 {
+		return status.Errorf(codes.InvalidArgument, "fade durations are capped at 10s")
+	}
+	if req.CrossfadeMs < 0 || req.CrossfadeMs > 10000 {
+		return status.Errorf(codes.InvalidArgument, "crossfade_ms must be in [0, 10000]")
+	}
+	if req.MaxStartLatencyMs < 0 {
+		return status.Errorf(codes.InvalidArgument, "max_start_latency_ms must be >= 0")
+	}
+	if req.TrimSilenceMs < 0 || req.TrimSilenceMs > 5000 {
+		return status.Errorf(codes.InvalidArgument, "trim_silence_ms must be in [0, 5000]")
+	}
+	if req.TrimSilenceThreshold < 0 || req.TrimSilenceThreshold >= 1 {
+		return status.Errorf(codes.InvalidArgument, "trim_silence_threshold must be in [0, 1)")
+	}
+	if req.TrimSilenceThreshold != 0 && req.TrimSilenceMs == 0 {
+		return status.Errorf(codes.InvalidArgument, "trim_silence_threshold requires trim_silence_ms")
+	}
+	if req.TrimSilenceMs > 0 && isLiveSource(req.AudioUrl) {
+		return status.Errorf(codes.InvalidArgument, "cannot trim a live source")
+	}
+	for name := range req.Headers {
+		if !allowedFetchHeaders[http.CanonicalHeaderKey(name)] {
+			return status.Errorf(codes.InvalidArgument, "header %q not allowed (allowed: %s)", name, allowedFetchHeaderList)
+		}
+	}
+	if req.StartOffsetMs > 0 {
+		if len(req.Items) > 0 {
+			return status.Errorf(codes.InvalidArgument, "start_offset_ms applies to audio_url, not items")
+		}
+		if strings.HasPrefix(req.AudioUrl, "rtsp://") || strings.HasPrefix(req.AudioUrl, "rtp://") {
+			return status.Errorf(codes.InvalidArgument, "cannot seek a live source")
+		}
+	}
+	if req.LoopCount > 1 || req.LoopForever {
+		if len(req.Items) > 0 {
+			return status.Errorf(codes.InvalidArgument, "loop options apply to audio_url, not items")
+		}
+		if strings.HasPrefix(req.AudioUrl, "rtsp://") || strings.HasPrefix(req.AudioUrl, "rtp://") {
+			return status.Errorf(codes.InvalidArgument, "cannot loop a live source")
+		}
+		if req.SampleRate != 0 {
+			return status.Errorf(codes.InvalidArgument, "cannot loop a raw PCM source")
+		}
+	}
+	return nil
+}
+
+// PlayAudio downloads an audio file (MP3/WAV), decodes and resamples it to
+// 16kHz mono, and writes it to the session's LiveKit track, streaming
+// lifecycle events back to the caller.
+func (s *LiveKitBridgeService) PlayAudio(req *pb.PlayAudioRequest, stream pb.LiveKitBridge_PlayAudioServer) error {
+	if err := validatePlayRequest(req); err != nil {
+		return err
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return status.Errorf(codes.FailedPrecondition, "no session for user %s", req.UserId)
+	}
+	if err := s.checkTenant(stream.Context(), session); err != nil {
+		return err
+	}
+	if session.quarantined.Load() {
+		return status.Errorf(codes.FailedPrecondition, "session for user %s is quarantined after a panic (rejoin to clear)", req.UserId)
+	}
+
+	// Attribution label for logs: "req-123 (app com.example.timer)".
+	who := req.RequestId
+	if req.AppId != "" {
+		who = req.RequestId + " (app " + req.AppId + ")"
+	}
+
+	// Policy gate (pushed policy first, then the user's stored DND
+	// preference): denied requests get a typed FAILED event (not a gRPC
+	// error) so apps can distinguish "blocked" from "broken".
+	code := s.policy.deny(req.UserId, req.AppId, time.Now())
+	if code == "" {
+		code = s.prefs.deny(req.UserId, session.tenant, time.Now())
+	}
+	if code != "" {
+		log.Printf("PlayAudio %s denied by policy (%s) for user %s", who, code, req.UserId)
+		return stream.Send(&pb.PlayAudioEvent{
+			Type:      pb.PlayAudioEvent_FAILED,
+			RequestId: req.RequestId,
+			Error:     "denied by audio policy",
+			Metadata:  map[string]string{"code": code},
+		})
+	}
+	req.Volume = s.policy.clampVolume(req.UserId, s.prefs.resolveVolume(req.UserId, session.tenant, req.Volume))
+
+	if req.StopOther {
+		if stopped := session.stopPlayback(); len(stopped) > 0 {
+			log.Printf("PlayAudio %s stops playbacks %v for user %s", who, stopped, req.UserId)
+		}
+	}
+
+	// Detached requests survive the event stream; everything else is
+	// cancelled with it.
+	if req.Detached {
+		return s.playDetached(session, req, who, stream)
+	}
+
+	playCtx, playCancel := context.WithCancel(stream.Context())
+	defer playCancel()
+	// Same-track requests preempt each other; across tracks the session
+	// is capped so an app can't open unbounded decode loops on one user.
+	preempted, err := session.beginPlayback(req.TrackId, req.RequestId, req.AppId, playCancel, s.config.MaxConcurrentPlaybacks, req.CrossfadeMs)
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "%v", err)
+	}
+	if preempted != "" {
+		log.Printf("PlayAudio %s preempts playback %s for user %s", who, preempted, req.UserId)
+	}
+	defer session.endPlayback(req.TrackId, req.RequestId)
+	s.results.markRunning(req.UserId, req.RequestId, session.tenant)
+
+	if err := stream.Send(&pb.PlayAudioEvent{
+		Type:      pb.PlayAudioEvent_STARTED,
+		RequestId: req.RequestId,
+	}); err != nil {
+		return err
+	}
+	s.emitPlaybackStarted(session, req)
+
+	stopProgress := s.startProgress(session, req, stream)
+	durationMs, err := s.runPlaybackProtected(playCtx, session, req)
+	stopProgress()
+	s.policy.recordUsage(req.UserId, req.AppId, durationMs)
+	s.tenants.recordPlayback(session.tenant, durationMs)
+	// Record the terminal event too: if the event stream breaks before
+	// the Send lands, the cloud can recover it via GetPlaybackResult.
+	ev := s.finishPlayback(session, req, who, durationMs, err)
+	s.results.store(req.UserId, req.RequestId, session.tenant, ev)
+	return stream.Send(ev)
+}
+
+// startProgress emits periodic PROGRESS events on the PlayAudio stream
+// while the clip plays, so the caller can render a position bar for
+// long clips. duration_ms is filled in once a decoder knows the clip
+// length. The returned stop function waits for the emitter to exit, so
+// the terminal Send never races a progress Send on the stream.
+func (s *LiveKitBridgeService) startProgress(session *RoomSession, req *pb.PlayAudioRequest, stream pb.LiveKitBridge_PlayAudioServer) func() {
+	if s.config.PlaybackProgressInterval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.config.PlaybackProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				positionMs, totalMs, ok := session.playbackProgress(req.TrackId, req.RequestId)
+				if !ok {
+					return
+				}
+				if err := stream.Send(&pb.PlayAudioEvent{
+					Type:       pb.PlayAudioEvent_PROGRESS,
+					RequestId:  req.RequestId,
+					PositionMs: positionMs,
+					DurationMs: totalMs,
+				}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// emitPlaybackStarted announces a playback on the session event bus.
+func (s *LiveKitBridgeService) emitPlaybackStarted(session *RoomSession, req *pb.PlayAudioRequest) {
+	attrs := map[string]string{"request_id": req.RequestId, "url": req.AudioUrl}
+	if req.AppId != "" {
+		attrs["app_id"] = req.AppId
+	}
+	if len(req.Items) > 0 {
+		attrs["items"] = fmt.Sprint(len(req.Items))
+	}
+	session.emit(pb.BridgeEvent_PLAYBACK_STARTED, attrs)
+}
+
+// runPlayback is the decode-and-write phase shared by attached and
+// detached requests: bed setup, item or single-URL dispatch, bed fade.
+// A bed failure degrades to bed-less playback: the main audio is the
+// point of the request, the bed is garnish.
+func (s *LiveKitBridgeService) runPlayback(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	// Start-latency budget: if the first samples have not reached the
+	// track in time, cancel the playback rather than let a slow fetch
+	// deliver a response the user has given up on. The bed fetch below
+	// spends from the same budget.
+	var lateStart atomic.Bool
+	if req.MaxStartLatencyMs > 0 {
+		budgetCtx, budgetCancel := context.WithCancel(ctx)
+		defer budgetCancel()
+		ctx = budgetCtx
+		started := session.firstWriteSignal(req.TrackId, req.RequestId)
+		go func() {
+			timer := time.NewTimer(time.Duration(req.MaxStartLatencyMs) * time.Millisecond)
+			defer timer.Stop()
+			select {
+			case <-started:
+			case <-budgetCtx.Done():
+			case <-timer.C:
+				lateStart.Store(true)
+				budgetCancel()
+			}
+		}()
+	}
+
+	var bed *bedMixer
+	if req.BackgroundUrl != "" {
+		if pcm, bedErr := s.fetchDecodedPCM(ctx, req.BackgroundUrl, req.Headers); bedErr != nil {
+			log.Printf("PlayAudio %s: background bed %s: %v (playing without bed)", req.RequestId, req.BackgroundUrl, bedErr)
+		} else {
+			bed = newBedMixer(pcm, req.BackgroundGain)
+			s.registerBed(req.RequestId, bed)
+			defer s.unregisterBed(req.RequestId)
+		}
+	}
+
+	var durationMs int64
+	var err error
+	switch {
+	case len(req.Items) > 0:
+		durationMs, err = s.playItems(ctx, session, req)
+	case req.LoopCount > 1 || req.LoopForever:
+		durationMs, err = s.playLooped(ctx, session, req)
+	default:
+		durationMs, err = s.playAudioFile(ctx, session, req)
+	}
+	if bed != nil && err == nil {
+		s.fadeOutBed(ctx, session, req, bed)
+	}
+	// A budget abort surfaces as the cancelled context; name it so the
+	// caller sees the typed failure, not a silent COMPLETED.
+	if lateStart.Load() && errors.Is(err, context.Canceled) {
+		err = &startLatencyError{budget: time.Duration(req.MaxStartLatencyMs) * time.Millisecond}
+	}
+	return durationMs, err
+}
+
+// runPlaybackProtected isolates decoder panics: the playback fails like
+// any other error, and the session is quarantined so the input that
+// tripped the panic can't immediately crash-loop it.
+func (s *LiveKitBridgeService) runPlaybackProtected(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	var durationMs int64
+	err := runProtected("playback "+req.RequestId, func() error {
+		var playErr error
+		durationMs, playErr = s.runPlayback(ctx, session, req)
+		return playErr
+	})
+	var pe *panicError
+	if errors.As(err, &pe) {
+		session.quarantine(pe.Error())
+	}
+	return durationMs, err
+}
+
+// finishPlayback logs, records, and emits a playback's outcome and
+// returns the terminal event for the caller (cancel counts as
+// completed: the user heard everything up to the stop).
+func (s *LiveKitBridgeService) finishPlayback(session *RoomSession, req *pb.PlayAudioRequest, who string, durationMs int64, err error) *pb.PlayAudioEvent {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Printf("playback %s stopped for user %s", who, req.UserId)
+			return &pb.PlayAudioEvent{
+				Type:       pb.PlayAudioEvent_COMPLETED,
+				RequestId:  req.RequestId,
+				PositionMs: durationMs,
+				DurationMs: durationMs,
+			}
+		}
+		log.Printf("playback %s failed for user %s: %v", who, req.UserId, err)
+		session.recordError("playback", "request %s: %v", who, err)
+		failAttrs := map[string]string{"request_id": req.RequestId, "error": err.Error()}
+		if req.AppId != "" {
+			failAttrs["app_id"] = req.AppId
+		}
+		session.emit(pb.BridgeEvent_PLAYBACK_FAILED, failAttrs)
+		var meta map[string]string
+		var ufe *unsupportedFormatError
+		var ace *audioCapError
+		var sle *startLatencyError
+		if errors.Is(err, ErrPlaybackStalled) {
+			meta = map[string]string{"code": "PLAYBACK_STALLED"}
+		} else if errors.Is(err, ErrPlaybackTimeout) {
+			meta = map[string]string{"code": "PLAYBACK_TIMEOUT"}
+		} else if errors.As(err, &sle) {
+			meta = map[string]string{
+				"code":      startLatencyCode,
+				"budget_ms": strconv.FormatInt(req.MaxStartLatencyMs, 10),
+			}
+		} else if errors.As(err, &ace) {
+			meta = map[string]string{"code": ace.code, "limit": ace.limit}
+		} else if errors.As(err, &ufe) {
+			meta = map[string]string{
+				"code":              "UNSUPPORTED_FORMAT",
+				"content_type":      ufe.contentType,
+				"supported_formats": strings.Join(supportedPlaybackFormats, "; "),
+			}
+		}
+		return &pb.PlayAudioEvent{
+			Type:      pb.PlayAudioEvent_FAILED,
+			RequestId: req.RequestId,
+			Error:     err.Error(),
+			Metadata:  meta,
+		}
+	}
+
+	doneAttrs := map[string]string{"request_id": req.RequestId}
+	if req.AppId != "" {
+		doneAttrs["app_id"] = req.AppId
+	}
+	session.emit(pb.BridgeEvent_PLAYBACK_COMPLETED, doneAttrs)
+	return &pb.PlayAudioEvent{
+		Type:       pb.PlayAudioEvent_COMPLETED,
+		RequestId:  req.RequestId,
+		DurationMs: durationMs,
+		PositionMs: durationMs,
+	}
+}
+
+// StopAudio cancels the session's active playback.
+func (s *LiveKitBridgeService) StopAudio(ctx context.Context, req *pb.StopAudioRequest) (*pb.StopAudioResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.StopAudioResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	if req.RequestId != "" {
+		stopped := session.stopPlaybackRequest(req.RequestId)
+		if stopped != "" && req.Reason != "" {
+			log.Printf("stopped playback %s for user %s: %s", stopped, req.UserId, req.Reason)
+		}
+		return &pb.StopAudioResponse{Success: true, StoppedRequestId: stopped}, nil
+	}
+	stopped := session.stopPlayback()
+	if len(stopped) > 0 && req.Reason != "" {
+		log.Printf("stopped playbacks %v for user %s: %s", stopped, req.UserId, req.Reason)
+	}
+	resp := &pb.StopAudioResponse{Success: true}
+	if len(stopped) > 0 {
+		resp.StoppedRequestId = stopped[0]
+	}
+	return resp, nil
+}
+
+// StopAudioBatch stops playback for many users in one call. Sessions
+// owned by other tenants are skipped rather than rejected, so an
+// over-broad user list cannot probe which users exist elsewhere.
+func (s *LiveKitBridgeService) StopAudioBatch(ctx context.Context, req *pb.StopAudioBatchRequest) (*pb.StopAudioBatchResponse, error) {
+	tenant := tenantFromContext(ctx)
+
+	var sessions []*RoomSession
+	s.mu.Lock()
+	if len(req.UserIds) == 0 {
+		for _, session := range s.sessions {
+			sessions = append(sessions, session)
+		}
+	} else {
+		for _, userID := range req.UserIds {
+			if session, ok := s.sessions[userID]; ok {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	var sessionsStopped, playbacksStopped int32
+	for _, session := range sessions {
+		if session.tenant != tenant {
+			continue
+		}
+		var stopped []string
+		if req.TrackFilter {
+			if requestID := session.stopPlaybackTrack(req.TrackId); requestID != "" {
+				stopped = []string{requestID}
+			}
+		} else {
+			stopped = session.stopPlayback()
+		}
+		if len(stopped) > 0 {
+			sessionsStopped++
+			playbacksStopped += int32(len(stopped))
+		}
+	}
+	if playbacksStopped > 0 {
+		log.Printf("batch stopped %d playbacks across %d sessions (%d users requested): %s",
+			playbacksStopped, sessionsStopped, len(req.UserIds), req.Reason)
+	}
+	return &pb.StopAudioBatchResponse{
+		Success:          true,
+		SessionsStopped:  sessionsStopped,
+		PlaybacksStopped: playbacksStopped,
+	}, nil
+}
+
+// PauseAudio holds the playback on a track in place: the decode loop
+// blocks before its next write, so nothing is skipped.
+func (s *LiveKitBridgeService) PauseAudio(ctx context.Context, req *pb.PauseAudioRequest) (*pb.PauseAudioResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.PauseAudioResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	requestID := session.pausePlayback(req.TrackId)
+	if requestID == "" {
+		return &pb.PauseAudioResponse{Success: false, Error: "no active playback on track"}, nil
+	}
+	log.Printf("paused playback %s on track '%s' for user %s", requestID, trackName(req.TrackId), req.UserId)
+	return &pb.PauseAudioResponse{Success: true, RequestId: requestID}, nil
+}
+
+// ResumeAudio releases a paused playback from where it stopped.
+func (s *LiveKitBridgeService) ResumeAudio(ctx context.Context, req *pb.ResumeAudioRequest) (*pb.ResumeAudioResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.ResumeAudioResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	requestID := session.resumePlayback(req.TrackId)
+	if requestID == "" {
+		return &pb.ResumeAudioResponse{Success: false, Error: "no active playback on track"}, nil
+	}
+	log.Printf("resumed playback %s on track '%s' for user %s", requestID, trackName(req.TrackId), req.UserId)
+	return &pb.ResumeAudioResponse{Success: true, RequestId: requestID}, nil
+}
+
+// SetTrackVolume adjusts a track's live gain: the new value applies
+// from the next sample block, so the app can follow user volume changes
+// without restarting the clip. The gain multiplies the playing
+// request's own volume and stays on the track for the session's life.
+func (s *LiveKitBridgeService) SetTrackVolume(ctx context.Context, req *pb.SetTrackVolumeRequest) (*pb.SetTrackVolumeResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if req.Volume < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "volume must be >= 0")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.SetTrackVolumeResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	volume := s.policy.clampVolume(req.UserId, req.Volume)
+	session.setTrackGain(req.TrackId, volume)
+	log.Printf("track '%s' gain set to %.2f for user %s", trackName(req.TrackId), volume, req.UserId)
+	return &pb.SetTrackVolumeResponse{Success: true}, nil
+}
+
+// playItems plays a composite request item by item through the normal
+// single-URL path, each with its own gain, with optional silence gaps
+// in between. The whole sequence shares the caller's lifecycle: one
+// STARTED, one COMPLETED/FAILED, one cancel.
+func (s *LiveKitBridgeService) playItems(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	var totalMs int64
+	for i, item := range req.Items {
+		volume := req.Volume
+		if item.Gain > 0 {
+			volume = s.policy.clampVolume(req.UserId, item.Gain)
+		}
+		itemReq := &pb.PlayAudioRequest{
+			RequestId:            req.RequestId,
+			AudioUrl:             item.AudioUrl,
+			Volume:               volume,
+			UserId:               req.UserId,
+			TrackId:              req.TrackId,
+			AppId:                req.AppId,
+			Headers:              req.Headers,
+			TrackSampleRate:      req.TrackSampleRate,
+			OutputChannels:       req.OutputChannels,
+			PlaybackRate:         req.PlaybackRate,
+			TrimSilenceMs:        req.TrimSilenceMs,
+			TrimSilenceThreshold: req.TrimSilenceThreshold,
+		}
+		ms, err := s.playAudioFile(ctx, session, itemReq)
+		totalMs += ms
+		if err != nil {
+			return totalMs, fmt.Errorf("item %d (%s): %w", i, item.AudioUrl, err)
+		}
+		if item.GapMs > 0 {
+			ms, err := s.playGap(ctx, session, itemReq, item.GapMs)
+			totalMs += ms
+			if err != nil {
+				return totalMs, err
+			}
+		}
+	}
+	return totalMs, nil
+}
+
+// playGap writes silence to the track so inter-item spacing follows the
+// track clock instead of a wall-clock sleep.
+func (s *LiveKitBridgeService) playGap(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, gapMs int64) (int64, error) {
+	writer := s.newTrackWriter(session, req)
+	// A gap is silence by design; the request's silence trim must not
+	// shorten it.
+	writer.trimThreshold, writer.trimLeadLeft, writer.trimTrailMax = 0, 0, 0
+	remaining := gapMs * int64(playbackSampleRate*writer.channels) / 1000
+	var played int64
+	for remaining > 0 {
+		if err := ctx.Err(); err != nil {
+			return playedSamplesToMs(played), err
+		}
+		n := int64(playbackSampleRate / 10 * writer.channels) // ~100ms
+		if n > remaining {
+			n = remaining
+		}
+		if err := writer.write(make([]int16, n)); err != nil {
+			return playedSamplesToMs(played), fmt.Errorf("write gap: %w", err)
+		}
+		played += n / int64(writer.channels)
+		remaining -= n
+	}
+	return playedSamplesToMs(played), nil
+}
+
+// isLiveSource reports whether the URL is a live RTSP/RTP feed, which
+// bypasses caching, prefetch, and the fetched-audio caps.
+func isLiveSource(url string) bool {
+	return strings.HasPrefix(url, "rtsp://") || strings.HasPrefix(url, "rtp://")
+}
+
+// playAudioFile fetches the URL and routes to the right decoder based on
+// Content-Type (falling back to the URL extension). Returns the played
+// duration in milliseconds.
+func (s *LiveKitBridgeService) playAudioFile(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	// Live feeds: no cache, no prefetch, runs until cancelled.
+	if isLiveSource(req.AudioUrl) {
+		return s.playRTPSource(ctx, session, req)
+	}
+
+	// The decode cache stores mono; stereo requests bypass it entirely
+	// rather than getting a cached downmix of what they asked to keep.
+	useCache := s.audioCache != nil && req.OutputChannels != 2
+	if useCache {
+		if pcm := s.audioCache.get(req.AudioUrl); pcm != nil {
+			pcm, err := seekPCM(pcm, req.StartOffsetMs)
+			if err != nil {
+				return 0, err
+			}
+			return s.playFromPCM(ctx, session, req, pcm)
+		}
+	}
+
+	// s3://gs:// URIs become presigned HTTPS here; the cache above stays
+	// keyed by the original URI so the signature doesn't defeat it.
+	fetchURL, err := s.resolveAudioURL(req.AudioUrl)
+	if err != nil {
+		return 0, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("bad audio url: %w", err)
+	}
+	// Caller-supplied auth headers and the configured User-Agent go on
+	// every request of the download, follow-ups included.
+	fetchHdr := s.audioFetchHeaders(req.Headers)
+	setFetchHeaders(httpReq, fetchHdr)
+	// Ask for the first segment only; a 206 reply means the source is
+	// seekable and the rest can be prefetched in parallel with decoding.
+	// Servers without Range support ignore the header and reply 200.
+	if s.config.AudioPrefetchSegment > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=0-%d", s.config.AudioPrefetchSegment-1))
+	}
+	// An expired cache entry with an ETag is revalidated rather than
+	// re-fetched; 304 means the decoded PCM is still good.
+	if useCache {
+		if etag := s.audioCache.staleETag(req.AudioUrl); etag != "" {
+			httpReq.Header.Set("If-None-Match", etag)
+		}
+	}
+	resp, err := s.doAudioFetch(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("fetch audio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && useCache {
+		if pcm := s.audioCache.refresh(req.AudioUrl); pcm != nil {
+			pcm, err := seekPCM(pcm, req.StartOffsetMs)
+			if err != nil {
+				return 0, err
+			}
+			return s.playFromPCM(ctx, session, req, pcm)
+		}
+		return 0, fmt.Errorf("fetch audio: HTTP 304 but cache entry gone")
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("fetch audio: HTTP %d", resp.StatusCode)
+	}
+
+	// For seekable sources bigger than one segment, keep one segment of
+	// download ahead of the decoder to ride out CDN throughput dips.
+	body := io.Reader(resp.Body)
+	if resp.StatusCode == http.StatusPartialContent {
+		total := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		if total > s.config.AudioPrefetchSegment {
+			pr := newPrefetchReader(ctx, s.audioHTTP, fetchURL,
+				s.config.AudioPrefetchSegment, total, s.config.AudioPrefetchSegment, fetchHdr)
+			defer pr.Close()
+			body = io.MultiReader(resp.Body, pr)
+		}
+	} else if resp.Header.Get("Icy-Metaint") == "" {
+		// One-shot download with no Range support announced: resume
+		// from the last byte if the connection drops mid-file rather
+		// than failing the playback. ICY streams are live — there is
+		// no byte position to resume from.
+		rr := newResumeReader(ctx, s.audioHTTP, fetchURL, resp.Header.Get("ETag"), resp.Body, fetchHdr)
+		defer rr.Close()
+		body = rr
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	urlPath := strings.ToLower(req.AudioUrl)
+	if i := strings.Index(urlPath, "?"); i >= 0 {
+		urlPath = urlPath[:i]
+	}
+
+	// ICY/Shoutcast servers that interleave metadata announce it via
+	// icy-metaint; strip it so the MP3 decoder sees clean frames.
+	if metaint, _ := strconv.Atoi(resp.Header.Get("Icy-Metaint")); metaint > 0 {
+		log.Printf("playback %s: icy stream %q (metaint %d) for user %s",
+			req.RequestId, resp.Header.Get("Icy-Name"), metaint, req.UserId)
+		body = newICYReader(body, metaint)
+	}
+
+	// Download cap: the decoders read until EOF, so without it a
+	// mispointed URL streams forever.
+	if s.config.AudioMaxBytes > 0 {
+		body = &cappedReader{r: body, max: s.config.AudioMaxBytes}
+	}
+
+	// While decoding, collect the pre-gain 16kHz mono stream so the next
+	// session asking for the same URL skips fetch and decode entirely.
+	// A seek decodes only part of the file, which must not be cached.
+	var collected []int16
+	var collect func([]int16)
+	if useCache && req.StartOffsetMs == 0 {
+		collect = func(chunk []int16) { collected = append(collected, chunk...) }
+	}
+	var ab *resamplerAB
+	if s.config.ResamplerAB {
+		ab = &resamplerAB{}
+	}
+
+	var durationMs int64
+	if req.SampleRate > 0 {
+		// Request-declared raw PCM bypasses content sniffing entirely.
+		log.Printf("playback %s: codec=raw-pcm rate=%d channels=%d for user %s",
+			req.RequestId, req.SampleRate, req.Channels, req.UserId)
+		durationMs, err = s.playRawPCM(ctx, session, body, req, collect, ab)
+	} else {
+		dec := decoderFor(contentType, urlPath)
+		if dec == nil {
+			return 0, &unsupportedFormatError{contentType: contentType}
+		}
+		log.Printf("playback %s: codec=%s content-type=%q for user %s",
+			req.RequestId, dec.name, contentType, req.UserId)
+		durationMs, err = dec.play(s, ctx, session, body, req, collect, ab)
+	}
+	if ab != nil {
+		ab.report(req.RequestId)
+	}
+	// Only complete decodes are cached; a cancel mid-file leaves a
+	// truncated clip that must not be served to the next caller.
+	if err == nil && collect != nil {
+		s.audioCache.put(req.AudioUrl, resp.Header.Get("ETag"), collected)
+	}
+	return durationMs, err
+}
+
+// playLooped fetches and fully decodes the clip once, then replays the
+// PCM for each iteration. Re-fetching the URL per loop would hammer the
+// origin for hold-music style requests, so the decode is reused even
+// when the shared cache is disabled.
+func (s *LiveKitBridgeService) playLooped(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	pcm, err := s.fetchDecodedPCM(ctx, req.AudioUrl, req.Headers)
+	if err != nil {
+		return 0, err
+	}
+	// A start offset applies to the first pass only; later loops play
+	// the whole clip.
+	first, err := seekPCM(pcm, req.StartOffsetMs)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for i := int32(0); req.LoopForever || i < req.LoopCount; i++ {
+		cur := pcm
+		if i == 0 {
+			cur = first
+		}
+		ms, err := s.playFromPCM(ctx, session, req, cur)
+		total += ms
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// seekPCM returns the decoded clip from offsetMs onward.
+func seekPCM(pcm []int16, offsetMs int64) ([]int16, error) {
+	if offsetMs <= 0 {
+		return pcm, nil
+	}
+	skip := int(offsetMs * int64(playbackSampleRate) / 1000)
+	if skip >= len(pcm) {
+		return nil, fmt.Errorf("start offset %dms is past the end of the clip", offsetMs)
+	}
+	return pcm[skip:], nil
+}
+
+// playPrefetched plays a queue entry whose audio was decoded while the
+// previous entry played (gapless handoff), with the same panic
+// isolation as the normal path.
+func (s *LiveKitBridgeService) playPrefetched(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, pcm []int16) (int64, error) {
+	var durationMs int64
+	err := runProtected("playback "+req.RequestId, func() error {
+		cur, seekErr := seekPCM(pcm, req.StartOffsetMs)
+		if seekErr != nil {
+			return seekErr
+		}
+		var playErr error
+		durationMs, playErr = s.playFromPCM(ctx, session, req, cur)
+		return playErr
+	})
+	var pe *panicError
+	if errors.As(err, &pe) {
+		session.quarantine(pe.Error())
+	}
+	return durationMs, err
+}
+
+// playFromPCM plays an already-decoded 16kHz mono clip (a cache hit or
+// a loop iteration). The DSP chain runs on a copy so the shared PCM
+// stays pristine.
+func (s *LiveKitBridgeService) playFromPCM(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, pcm []int16) (int64, error) {
+	writer := s.newTrackWriter(session, req)
+	// Loops replay the same PCM with a cumulative position; a
+	// per-iteration duration there would read as >100% progress.
+	if req.LoopCount <= 1 && !req.LoopForever {
+		writer.expectedMs = int64(float64(playedSamplesToMs(int64(len(pcm)))) / writer.rate)
+	}
+	chunkSize := playbackSampleRate / 10 // ~100ms
+	var playedSamples int64
+	for off := 0; off < len(pcm); off += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return playedSamplesToMs(playedSamples), err
+		}
+		end := off + chunkSize
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		out := make([]int16, end-off)
+		copy(out, pcm[off:end])
+		// Decoded-PCM clips are always mono; a stereo writer plays them
+		// centered.
+		if writer.channels == 2 {
+			out = monoToStereo(out)
+		}
+		if err := writer.write(out); err != nil {
+			return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+		}
+		playedSamples += int64(end - off)
+	}
+	if err := writer.finish(); err != nil {
+		return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+	}
+	return playedSamplesToMs(playedSamples), nil
+}
+
+// playMP3 streams an MP3 through decode → downmix → resample → DSP
+// chain → WriteSample (the chain runs inside the writer). go-mp3 always
+// outputs 16-bit stereo at the file's rate, so a stereo writer keeps
+// the decoder's L/R as is.
+func (s *LiveKitBridgeService) playMP3(ctx context.Context, session *RoomSession, r io.Reader, req *pb.PlayAudioRequest, collect func([]int16), ab *resamplerAB) (int64, error) {
+	frames, r := mp3SniffXing(r)
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return 0, fmt.Errorf("mp3 decode: %w", err)
+	}
+	srcRate := dec.SampleRate()
+	writer := s.newTrackWriter(session, req)
+
+	if req.StartOffsetMs > 0 {
+		// Seek by decoding and discarding: MP3 frames aren't
+		// byte-addressable without a full seek table.
+		skipBytes := req.StartOffsetMs * int64(srcRate) / 1000 * 4
+		if _, err := io.CopyN(io.Discard, dec, skipBytes); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("mp3 seek: %w", err)
+		}
+	}
+
+	// 1152 samples per MPEG-1 Layer III frame.
+	expectedMs := frames * 1152 * 1000 / int64(srcRate)
+	if expectedMs > 0 && req.StartOffsetMs < expectedMs {
+		expectedMs -= req.StartOffsetMs
+	}
+	// Slowed-down playback takes longer than the source duration.
+	writer.expectedMs = int64(float64(expectedMs) / playbackRate(req))
+	deadline := playbackDeadline(writer.expectedMs)
+
+	// ~100ms of decoded stereo bytes per iteration.
+	buf := make([]byte, srcRate/10*4)
+	var playedSamples int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return playedSamplesToMs(playedSamples), err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline.Add(session.pausedExtra(req.TrackId))) {
+			return playedSamplesToMs(playedSamples), fmt.Errorf("mp3 playback: %w", ErrPlaybackTimeout)
+		}
+		t := time.Now()
+		n, err := io.ReadFull(dec, buf)
+		if n > 0 {
+			stereo := bytesToInt16(buf[:n-n%4])
+			var out []int16
+			if writer.channels == 2 {
+				out = resampleInterleaved(stereo, 2, srcRate, playbackSampleRate)
+			} else {
+				mono := downmixToMono(stereo, 2)
+				out = resampleForPlayback(ab, mono, srcRate)
+			}
+			session.chargeDecode(t)
+			if collect != nil {
+				collect(out)
+			}
+			if err := writer.write(out); err != nil {
+				return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+			}
+			playedSamples += int64(len(out) / writer.channels)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return playedSamplesToMs(playedSamples), fmt.Errorf("mp3 read: %w", err)
+		}
+	}
+	if err := writer.finish(); err != nil {
+		return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+	}
+	return playedSamplesToMs(playedSamples), nil
+}
+
+// playWAV streams a 16-bit PCM WAV through the same pipeline as MP3.
+func (s *LiveKitBridgeService) playWAV(ctx context.Context, session *RoomSession, r io.Reader, req *pb.PlayAudioRequest, collect func([]int16), ab *resamplerAB) (int64, error) {
+	sampleRate, channels, dataBytes, err := readWAVHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("wav decode: %w", err)
+	}
+	if req.StartOffsetMs > 0 {
+		// PCM is byte-addressable: skip whole frames at the byte rate.
+		skip := req.StartOffsetMs * int64(sampleRate*channels*2) / 1000
+		skip -= skip % int64(2*channels)
+		if dataBytes > 0 && skip >= dataBytes {
+			return 0, fmt.Errorf("start offset %dms is past the end of the clip", req.StartOffsetMs)
+		}
+		if _, err := io.CopyN(io.Discard, r, skip); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("wav seek: %w", err)
+		}
+		if dataBytes > 0 {
+			dataBytes -= skip
+		}
+	}
+	writer := s.newTrackWriter(session, req)
+	writer.expectedMs = int64(float64(wavExpectedMs(dataBytes, sampleRate, channels)) / playbackRate(req))
+	deadline := playbackDeadline(writer.expectedMs)
+	return s.playPCMStream(ctx, writer, r, sampleRate, channels, deadline, collect, ab)
+}
+
+// playRawPCM streams headerless PCM with caller-declared parameters
+// (PlayAudioRequest.sample_rate and friends) through the same pipeline
+// as WAV. The source size is unknown, so there is no deadline.
+func (s *LiveKitBridgeService) playRawPCM(ctx context.Context, session *RoomSession, r io.Reader, req *pb.PlayAudioRequest, collect func([]int16), ab *resamplerAB) (int64, error) {
+	channels := int(req.Channels)
+	if channels == 0 {
+		channels = 1
+	}
+	writer := s.newTrackWriter(session, req)
+	return s.playPCMStream(ctx, writer, r, int(req.SampleRate), channels, time.Time{}, collect, ab)
+}
+
+// playPCMStream is the 16-bit PCM read loop shared by the WAV and raw
+// paths: downmix → resample → collect → write, ~100ms per iteration.
+func (s *LiveKitBridgeService) playPCMStream(ctx context.Context, writer *trackWriter, r io.Reader, sampleRate, channels int, deadline time.Time, collect func([]int16), ab *resamplerAB) (int64, error) {
+	frameBytes := 2 * channels
+	buf := make([]byte, sampleRate/10*frameBytes) // ~100ms
+	var playedSamples int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return playedSamplesToMs(playedSamples), err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline.Add(writer.session.pausedExtra(writer.trackID))) {
+			return playedSamplesToMs(playedSamples), fmt.Errorf("pcm playback: %w", ErrPlaybackTimeout)
+		}
+		t := time.Now()
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			src := bytesToInt16(buf[:n-n%frameBytes])
+			var out []int16
+			if writer.channels == 2 {
+				st := src
+				if channels == 1 {
+					st = monoToStereo(src)
+				}
+				out = resampleInterleaved(st, 2, sampleRate, playbackSampleRate)
+			} else {
+				mono := downmixToMono(src, channels)
+				out = resampleForPlayback(ab, mono, sampleRate)
+			}
+			writer.session.chargeDecode(t)
+			if collect != nil {
+				collect(out)
+			}
+			if err := writer.write(out); err != nil {
+				return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+			}
+			playedSamples += int64(len(out) / writer.channels)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return playedSamplesToMs(playedSamples), fmt.Errorf("pcm read: %w", err)
+		}
+	}
+	if err := writer.finish(); err != nil {
+		return playedSamplesToMs(playedSamples), fmt.Errorf("write sample: %w", err)
+	}
+	return playedSamplesToMs(playedSamples), nil
+}
+
+// readWAVHeader consumes RIFF chunks up to the start of 'data' and
+// returns the stream's sample rate, channel count, and data chunk size
+// in bytes. Only 16-bit PCM is supported. Streaming encoders write a
+// bogus ~0xFFFFFFFF size; that is reported as 0 (unknown).
+func readWAVHeader(r io.Reader) (sampleRate, channels int, dataBytes int64, err error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0, 0, 0, errors.New("not a RIFF/WAVE file")
+	}
+	for {
+		chunkHeader := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return 0, 0, 0, fmt.Errorf("read chunk header: %w", err)
+		}
+		id := string(chunkHeader[0:4])
+		size := int(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		if id == "data" {
+			if sampleRate == 0 {
+				return 0, 0, 0, errors.New("data chunk before fmt chunk")
+			}
+			dataBytes = int64(size)
+			if dataBytes >= 0xFFFFFFF0 {
+				dataBytes = 0
+			}
+			return sampleRate, channels, dataBytes, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, 0, 0, fmt.Errorf("read chunk %s: %w", id, err)
+		}
+		if id == "fmt " {
+			if size < 16 {
+				return 0, 0, 0, errors.New("fmt chunk too small")
+			}
+			if af := binary.LittleEndian.Uint16(payload[0:2]); af != 1 {
+				return 0, 0, 0, fmt.Errorf("unsupported wav format=%d", af)
+			}
+			channels = int(binary.LittleEndian.Uint16(payload[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(payload[4:8]))
+			if bits := binary.LittleEndian.Uint16(payload[14:16]); bits != 16 {
+				return 0, 0, 0, fmt.Errorf("need 16-bit pcm, got %d", bits)
+			}
+			if channels < 1 || channels > 2 {
+				return 0, 0, 0, fmt.Errorf("unsupported channels=%d", channels)
+			}
+		}
+	}
+}
+
+// wavExpectedMs converts a known data chunk size to clip duration.
+func wavExpectedMs(dataBytes int64, sampleRate, channels int) int64 {
+	if dataBytes <= 0 {
+		return 0
+	}
+	return dataBytes * 1000 / int64(sampleRate*channels*2)
+}
+
+// mp3SniffXing looks for a Xing/Info header in the first 4KB and
+// returns the frame count (0 if absent — CBR files without the tag get
+// no deadline) plus a reader replaying the sniffed bytes.
+func mp3SniffXing(r io.Reader) (int64, io.Reader) {
+	head := make([]byte, 4096)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	rd := io.MultiReader(bytes.NewReader(head), r)
+	for i := 0; i+12 <= len(head); i++ {
+		tag := string(head[i : i+4])
+		if tag != "Xing" && tag != "Info" {
+			continue
+		}
+		flags := binary.BigEndian.Uint32(head[i+4 : i+8])
+		if flags&1 != 0 { // FRAMES flag
+			return int64(binary.BigEndian.Uint32(head[i+8 : i+12])), rd
+		}
+		break
+	}
+	return 0, rd
+}
+
+// monoToStereo duplicates a mono signal into interleaved L/R.
+func monoToStereo(samples []int16) []int16 {
+	out := make([]int16, len(samples)*2)
+	for i, s := range samples {
+		out[2*i] = s
+		out[2*i+1] = s
+	}
+	return out
+}
+
+// splitStereo separates an interleaved stereo block into its channels.
+func splitStereo(samples []int16) (left, right []int16) {
+	n := len(samples) / 2
+	left = make([]int16, n)
+	right = make([]int16, n)
+	for i := 0; i < n; i++ {
+		left[i] = samples[2*i]
+		right[i] = samples[2*i+1]
+	}
+	return left, right
+}
+
+// interleaveStereo writes two channels back into an interleaved block.
+func interleaveStereo(dst, left, right []int16) {
+	for i := range left {
+		dst[2*i] = left[i]
+		dst[2*i+1] = right[i]
+	}
+}
+
+// resampleInterleaved resamples each channel of an interleaved signal
+// independently; resampleLinear on interleaved frames would interpolate
+// left samples with right ones.
+func resampleInterleaved(samples []int16, channels, fromRate, toRate int) []int16 {
+	if channels <= 1 || fromRate == toRate {
+		return resampleLinear(samples, fromRate, toRate)
+	}
+	left, right := splitStereo(samples)
+	left = resampleLinear(left, fromRate, toRate)
+	right = resampleLinear(right, fromRate, toRate)
+	out := make([]int16, len(left)*2)
+	interleaveStereo(out, left, right)
+	return out
+}
+
+// downmixToMono averages interleaved channels into one.
+func downmixToMono(samples []int16, channels int) []int16 {
+	if channels <= 1 {
+		return samples
+	}
+	mono := make([]int16, len(samples)/channels)
+	for i := range mono {
+		var sum int
+		for c := 0; c < channels; c++ {
+			sum += int(samples[i*channels+c])
+		}
+		mono[i] = int16(sum / channels)
+	}
+	return mono
+}
+
+// resampleLinear converts mono PCM between sample rates with linear
+// interpolation. Good enough for speech; cheap enough for many sessions.
+func resampleLinear(samples []int16, fromRate, toRate int) []int16 {
+	if fromRate == toRate || len(samples) == 0 {
+		return samples
+	}
+	outLen := len(samples) * toRate / fromRate
+	out := make([]int16, outLen)
+	for i := range out {
+		srcPos := float64(i) * float64(fromRate) / float64(toRate)
+		j := int(srcPos)
+		if j >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := srcPos - float64(j)
+		out[i] = int16(float64(samples[j])*(1-frac) + float64(samples[j+1])*frac)
+	}
+	return out
+}
+
+// applyGain scales samples in place, clipping at int16 range.
+func applyGain(samples []int16, gain float64) {
+	if gain == 1.0 {
+		return
+	}
+	for i, v := range samples {
+		scaled := float64(v) * gain
+		if scaled > 32767 {
+			scaled = 32767
+		} else if scaled < -32768 {
+			scaled = -32768
+		}
+		samples[i] = int16(scaled)
+	}
+}
+
+func volumeOrDefault(v float32) float32 {
+	if v <= 0 {
+		return 1.0
+	}
+	return v
+}
+
+func playedSamplesToMs(samples int64) int64 {
+	return samples * 1000 / int64(playbackSampleRate)
+}
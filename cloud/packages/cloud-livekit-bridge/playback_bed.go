@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	mp3 "github.com/hajimehoshi/go-mp3"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Background bed: a looping low-volume clip mixed under everything a
+// playback request writes to its track, faded out when the main audio
+// ends. Decoded once up front (beds are short ambient loops), then
+// mixed per block in trackWriter.write after the DSP chain.
+
+const (
+	bedDefaultGain = 0.2
+	bedFadeMs      = 500
+)
+
+// bedMixer loops a decoded 16kHz mono clip under playback blocks. It
+// tracks its own loop position, so the bed is continuous across the
+// items and gaps of a composite request. All access is from the
+// request's single playback goroutine.
+type bedMixer struct {
+	pcm  []int16
+	gain float64
+	pos  int
+}
+
+func newBedMixer(pcm []int16, gain float32) *bedMixer {
+	g := float64(gain)
+	if g <= 0 {
+		g = bedDefaultGain
+	}
+	return &bedMixer{pcm: pcm, gain: g}
+}
+
+// mix adds the bed under a block in place, clipping at the rails.
+func (b *bedMixer) mix(samples []int16) {
+	if len(b.pcm) == 0 {
+		return
+	}
+	for i, s := range samples {
+		v := int(s) + int(float64(b.pcm[b.pos])*b.gain)
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		samples[i] = int16(v)
+		b.pos++
+		if b.pos == len(b.pcm) {
+			b.pos = 0
+		}
+	}
+}
+
+// registerBed attaches a bed to a request ID so track writers created
+// for that request pick it up.
+func (s *LiveKitBridgeService) registerBed(requestID string, bed *bedMixer) {
+	s.bedsMu.Lock()
+	defer s.bedsMu.Unlock()
+	s.beds[requestID] = bed
+}
+
+func (s *LiveKitBridgeService) unregisterBed(requestID string) {
+	s.bedsMu.Lock()
+	defer s.bedsMu.Unlock()
+	delete(s.beds, requestID)
+}
+
+func (s *LiveKitBridgeService) bedFor(requestID string) *bedMixer {
+	s.bedsMu.Lock()
+	defer s.bedsMu.Unlock()
+	return s.beds[requestID]
+}
+
+// fetchDecodedPCM fetches and fully decodes a clip to 16kHz mono,
+// through the shared decoded-PCM cache when it is enabled. Used for
+// clips that are replayed (beds, loops) rather than streamed once.
+// headers are the caller's allow-listed fetch headers, nil when the
+// fetch has no originating PlayAudioRequest.
+func (s *LiveKitBridgeService) fetchDecodedPCM(ctx context.Context, url string, headers map[string]string) ([]int16, error) {
+	if s.audioCache != nil {
+		if pcm := s.audioCache.get(url); pcm != nil {
+			return pcm, nil
+		}
+	}
+
+	fetchURL, err := s.resolveAudioURL(url)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("bad audio url: %w", err)
+	}
+	setFetchHeaders(httpReq, s.audioFetchHeaders(headers))
+	if s.audioCache != nil {
+		if etag := s.audioCache.staleETag(url); etag != "" {
+			httpReq.Header.Set("If-None-Match", etag)
+		}
+	}
+	resp, err := s.doAudioFetch(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("fetch audio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && s.audioCache != nil {
+		if pcm := s.audioCache.refresh(url); pcm != nil {
+			return pcm, nil
+		}
+		return nil, fmt.Errorf("fetch audio: HTTP 304 but cache entry gone")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch audio: HTTP %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	urlPath := strings.ToLower(url)
+	if i := strings.Index(urlPath, "?"); i >= 0 {
+		urlPath = urlPath[:i]
+	}
+
+	body := io.Reader(resp.Body)
+	if s.config.AudioMaxBytes > 0 {
+		body = &cappedReader{r: body, max: s.config.AudioMaxBytes}
+	}
+
+	var pcm []int16
+	switch {
+	case contentType == "audio/mpeg" || contentType == "audio/mp3" || strings.HasSuffix(urlPath, ".mp3"):
+		pcm, err = decodeMP3ToPCM(body)
+	case contentType == "audio/wav" || contentType == "audio/x-wav" || contentType == "audio/wave" || strings.HasSuffix(urlPath, ".wav"):
+		pcm, err = decodeWAVToPCM(body)
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.audioCache != nil {
+		s.audioCache.put(url, resp.Header.Get("ETag"), pcm)
+	}
+	return pcm, nil
+}
+
+// decodeMP3ToPCM decodes a whole MP3 into 16kHz mono PCM.
+func decodeMP3ToPCM(r io.Reader) ([]int16, error) {
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, fmt.Errorf("mp3 decode: %w", err)
+	}
+	raw, err := io.ReadAll(dec)
+	if err != nil {
+		return nil, fmt.Errorf("mp3 read: %w", err)
+	}
+	stereo := bytesToInt16(raw[:len(raw)-len(raw)%4])
+	mono := downmixToMono(stereo, 2)
+	return resampleLinear(mono, dec.SampleRate(), playbackSampleRate), nil
+}
+
+// decodeWAVToPCM decodes a whole 16-bit PCM WAV into 16kHz mono PCM.
+func decodeWAVToPCM(r io.Reader) ([]int16, error) {
+	sampleRate, channels, _, err := readWAVHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("wav decode: %w", err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("wav read: %w", err)
+	}
+	frameBytes := 2 * channels
+	src := bytesToInt16(raw[:len(raw)-len(raw)%frameBytes])
+	mono := downmixToMono(src, channels)
+	return resampleLinear(mono, sampleRate, playbackSampleRate), nil
+}
+
+// fadeOutBed ramps the bed to silence over bedFadeMs after the main
+// audio ends, instead of cutting it. Errors are logged, not returned:
+// the request's audio already played in full.
+func (s *LiveKitBridgeService) fadeOutBed(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, bed *bedMixer) {
+	writer := s.newTrackWriter(session, req)
+	start := bed.gain
+	steps := bedFadeMs / 100
+	chunk := make([]int16, playbackSampleRate/10)
+	for i := 0; i < steps; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		bed.gain = start * float64(steps-1-i) / float64(steps)
+		for j := range chunk {
+			chunk[j] = 0
+		}
+		if err := writer.write(chunk); err != nil {
+			log.Printf("bed fade for request %s: %v", req.RequestId, err)
+			return
+		}
+	}
+}
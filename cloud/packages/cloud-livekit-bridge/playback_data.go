@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// PlayAudioData plays audio bytes carried on the RPC itself: the first
+// chunk holds the playback parameters, every chunk may carry bytes, and
+// the decoders read them as they arrive. A TTS result plays without
+// being uploaded to a public URL first.
+//
+// The response is the terminal event only. Callers that want PROGRESS
+// events or need loops, beds, or composite items still go through
+// PlayAudio with a URL.
+func (s *LiveKitBridgeService) PlayAudioData(stream pb.LiveKitBridge_PlayAudioDataServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "no initial chunk: %v", err)
+	}
+	req := first.Request
+	if req == nil {
+		return status.Errorf(codes.InvalidArgument, "first chunk must carry the request")
+	}
+	if req.AudioUrl != "" || len(req.Items) > 0 {
+		return status.Errorf(codes.InvalidArgument, "inline playback carries its own bytes; audio_url and items must be empty")
+	}
+	switch {
+	case req.LoopCount > 1 || req.LoopForever:
+		return status.Errorf(codes.InvalidArgument, "cannot loop an inline byte stream")
+	case req.BackgroundUrl != "":
+		return status.Errorf(codes.InvalidArgument, "background_url does not apply to inline playback")
+	case req.Detached:
+		return status.Errorf(codes.InvalidArgument, "inline playback cannot outlive the stream carrying its bytes")
+	case req.MaxStartLatencyMs > 0:
+		return status.Errorf(codes.InvalidArgument, "max_start_latency_ms budgets a fetch; inline bytes have none")
+	}
+	if req.SampleRate == 0 && decoderFor(first.ContentType, "") == nil {
+		return status.Errorf(codes.InvalidArgument,
+			"content_type %q has no decoder (set sample_rate for raw PCM)", first.ContentType)
+	}
+	if err := validatePlayParams(req); err != nil {
+		return err
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return status.Errorf(codes.FailedPrecondition, "no session for user %s", req.UserId)
+	}
+	if err := s.checkTenant(stream.Context(), session); err != nil {
+		return err
+	}
+	if session.quarantined.Load() {
+		return status.Errorf(codes.FailedPrecondition, "session for user %s is quarantined after a panic (rejoin to clear)", req.UserId)
+	}
+
+	who := req.RequestId + " (inline)"
+	if req.AppId != "" {
+		who = req.RequestId + " (inline, app " + req.AppId + ")"
+	}
+
+	code := s.policy.deny(req.UserId, req.AppId, time.Now())
+	if code == "" {
+		code = s.prefs.deny(req.UserId, session.tenant, time.Now())
+	}
+	if code != "" {
+		log.Printf("PlayAudioData %s denied by policy (%s) for user %s", who, code, req.UserId)
+		return stream.SendAndClose(&pb.PlayAudioEvent{
+			Type:      pb.PlayAudioEvent_FAILED,
+			RequestId: req.RequestId,
+			Error:     "denied by audio policy",
+			Metadata:  map[string]string{"code": code},
+		})
+	}
+	req.Volume = s.policy.clampVolume(req.UserId, s.prefs.resolveVolume(req.UserId, session.tenant, req.Volume))
+
+	if req.StopOther {
+		if stopped := session.stopPlayback(); len(stopped) > 0 {
+			log.Printf("PlayAudioData %s stops playbacks %v for user %s", who, stopped, req.UserId)
+		}
+	}
+
+	playCtx, playCancel := context.WithCancel(stream.Context())
+	defer playCancel()
+	preempted, err := session.beginPlayback(req.TrackId, req.RequestId, req.AppId, playCancel, s.config.MaxConcurrentPlaybacks, req.CrossfadeMs)
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "%v", err)
+	}
+	if preempted != "" {
+		log.Printf("PlayAudioData %s preempts playback %s for user %s", who, preempted, req.UserId)
+	}
+	defer session.endPlayback(req.TrackId, req.RequestId)
+	s.results.markRunning(req.UserId, req.RequestId, session.tenant)
+	s.emitPlaybackStarted(session, req)
+
+	// Bridge the chunk stream into the decoders' io.Reader. Closing the
+	// read side on exit fails any Write still pending, so the receive
+	// goroutine never outlives the playback.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		if len(first.Data) > 0 {
+			if _, err := pw.Write(first.Data); err != nil {
+				return
+			}
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if len(chunk.Data) > 0 {
+				if _, err := pw.Write(chunk.Data); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	durationMs, err := s.playInlineProtected(playCtx, session, req, first.ContentType, pr)
+	s.policy.recordUsage(req.UserId, req.AppId, durationMs)
+	s.tenants.recordPlayback(session.tenant, durationMs)
+	ev := s.finishPlayback(session, req, who, durationMs, err)
+	s.results.store(req.UserId, req.RequestId, session.tenant, ev)
+	return stream.SendAndClose(ev)
+}
+
+// playInline routes the byte stream to a decoder the way playAudioFile
+// routes a fetched body: request-declared raw PCM bypasses the
+// registry, everything else dispatches on the declared content type.
+// Inline bytes are never cached — there is no URL to key them by.
+func (s *LiveKitBridgeService) playInline(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, contentType string, r io.Reader) (int64, error) {
+	if s.config.AudioMaxBytes > 0 {
+		r = &cappedReader{r: r, max: s.config.AudioMaxBytes}
+	}
+	var ab *resamplerAB
+	if s.config.ResamplerAB {
+		ab = &resamplerAB{}
+	}
+	var durationMs int64
+	var err error
+	if req.SampleRate > 0 {
+		log.Printf("playback %s: codec=raw-pcm rate=%d channels=%d (inline) for user %s",
+			req.RequestId, req.SampleRate, req.Channels, req.UserId)
+		durationMs, err = s.playRawPCM(ctx, session, r, req, nil, ab)
+	} else {
+		dec := decoderFor(contentType, "")
+		log.Printf("playback %s: codec=%s content-type=%q (inline) for user %s",
+			req.RequestId, dec.name, contentType, req.UserId)
+		durationMs, err = dec.play(s, ctx, session, r, req, nil, ab)
+	}
+	if ab != nil {
+		ab.report(req.RequestId)
+	}
+	return durationMs, err
+}
+
+// playInlineProtected gives inline playback the same panic isolation
+// and quarantine as runPlaybackProtected.
+func (s *LiveKitBridgeService) playInlineProtected(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest, contentType string, r io.Reader) (int64, error) {
+	var durationMs int64
+	err := runProtected("playback "+req.RequestId, func() error {
+		var playErr error
+		durationMs, playErr = s.playInline(ctx, session, req, contentType, r)
+		return playErr
+	})
+	var pe *panicError
+	if errors.As(err, &pe) {
+		session.quarantine(pe.Error())
+	}
+	return durationMs, err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Detached playback: the decode loop runs under the session's context
+// instead of the event stream's, so a flaky client connection doesn't
+// cancel audio the user should still hear. The stream gets events while
+// it lives; the terminal event is kept for playbackResultTTL and
+// retrievable by request ID via GetPlaybackResult.
+
+const playbackResultTTL = 10 * time.Minute
+
+// playbackResult is a playback's terminal state (event nil while it is
+// still running). The owning tenant is recorded on the result itself:
+// it deliberately outlives the session that checkTenant would consult.
+type playbackResult struct {
+	tenant string
+	event  *pb.PlayAudioEvent
+	doneAt time.Time
+}
+
+// playbackResults holds playback outcomes keyed "user/request" —
+// detached and attached alike, so a caller whose event stream broke
+// mid-playback can still learn how it ended. A plain mutex-and-map
+// with prune-on-write, like the policy engine.
+type playbackResults struct {
+	mu      sync.Mutex
+	results map[string]*playbackResult
+}
+
+func newPlaybackResults() *playbackResults {
+	return &playbackResults{results: make(map[string]*playbackResult)}
+}
+
+func (p *playbackResults) markRunning(userID, requestID, tenant string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results[userID+"/"+requestID] = &playbackResult{tenant: tenant}
+}
+
+func (p *playbackResults) store(userID, requestID, tenant string, event *pb.PlayAudioEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for key, r := range p.results {
+		if !r.doneAt.IsZero() && now.Sub(r.doneAt) > playbackResultTTL {
+			delete(p.results, key)
+		}
+	}
+	p.results[userID+"/"+requestID] = &playbackResult{tenant: tenant, event: event, doneAt: now}
+}
+
+func (p *playbackResults) get(userID, requestID string) *playbackResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.results[userID+"/"+requestID]
+}
+
+// playDetached starts the playback under the session context, feeds the
+// event stream for as long as the caller stays connected, and records
+// the terminal event either way.
+func (s *LiveKitBridgeService) playDetached(session *RoomSession, req *pb.PlayAudioRequest, who string, stream pb.LiveKitBridge_PlayAudioServer) error {
+	playCtx, playCancel := context.WithCancel(session.ctx)
+	preempted, err := session.beginPlayback(req.TrackId, req.RequestId, req.AppId, playCancel, s.config.MaxConcurrentPlaybacks, req.CrossfadeMs)
+	if err != nil {
+		playCancel()
+		return status.Errorf(codes.ResourceExhausted, "%v", err)
+	}
+	if preempted != "" {
+		log.Printf("PlayAudio %s preempts playback %s for user %s", who, preempted, req.UserId)
+	}
+	s.results.markRunning(req.UserId, req.RequestId, session.tenant)
+	if err := stream.Send(&pb.PlayAudioEvent{
+		Type:      pb.PlayAudioEvent_STARTED,
+		RequestId: req.RequestId,
+	}); err != nil {
+		// The caller is already gone; the playback runs regardless.
+		log.Printf("PlayAudio %s: started event not delivered: %v", who, err)
+	}
+	s.emitPlaybackStarted(session, req)
+
+	done := make(chan *pb.PlayAudioEvent, 1)
+	go func() {
+		defer playCancel()
+		defer session.endPlayback(req.TrackId, req.RequestId)
+		durationMs, err := s.runPlaybackProtected(playCtx, session, req)
+		s.policy.recordUsage(req.UserId, req.AppId, durationMs)
+		s.tenants.recordPlayback(session.tenant, durationMs)
+		ev := s.finishPlayback(session, req, who, durationMs, err)
+		s.results.store(req.UserId, req.RequestId, session.tenant, ev)
+		done <- ev
+	}()
+
+	select {
+	case ev := <-done:
+		return stream.Send(ev)
+	case <-stream.Context().Done():
+		log.Printf("PlayAudio %s: event stream dropped, detached playback continues for user %s", who, req.UserId)
+		return nil
+	}
+}
+
+// GetPlaybackResult reports a playback's final status by request ID
+// (or that it is still running). Terminal events are kept for
+// playbackResultTTL after completion.
+func (s *LiveKitBridgeService) GetPlaybackResult(ctx context.Context, req *pb.GetPlaybackResultRequest) (*pb.GetPlaybackResultResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if req.RequestId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "request_id required")
+	}
+	result := s.results.get(req.UserId, req.RequestId)
+	if result == nil {
+		return &pb.GetPlaybackResultResponse{Found: false}, nil
+	}
+	if result.tenant != tenantFromContext(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "user %s belongs to a different tenant", req.UserId)
+	}
+	return &pb.GetPlaybackResultResponse{
+		Found:   true,
+		Running: result.event == nil,
+		Event:   result.event,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Playback queue: the cloud enqueues full playback requests per track
+// and a per-track worker plays them back-to-back under the session's
+// lifetime, so a playlist doesn't need one synchronous PlayAudio stream
+// held open per clip. Entries behave like detached playbacks: terminal
+// events are recorded and retrievable via GetPlaybackResult.
+
+// trackQueue is one track's pending entries plus its worker state.
+// Guarded by the session's queueMu.
+type trackQueue struct {
+	pending []*pb.PlayAudioRequest
+	playing string // request ID the worker is on ("" between entries)
+	active  bool   // worker goroutine alive
+}
+
+// EnqueueAudio appends a playback request to its track's queue, starting
+// the queue worker if the track was idle.
+func (s *LiveKitBridgeService) EnqueueAudio(ctx context.Context, req *pb.EnqueueAudioRequest) (*pb.EnqueueAudioResponse, error) {
+	play := req.Request
+	if play == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "request required")
+	}
+	if play.RequestId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "request_id required (identifies the queue entry)")
+	}
+	if play.Detached {
+		return nil, status.Errorf(codes.InvalidArgument, "queued entries are implicitly detached")
+	}
+	if play.StopOther {
+		return nil, status.Errorf(codes.InvalidArgument, "stop_other does not apply to queued entries")
+	}
+	if err := validatePlayRequest(play); err != nil {
+		return nil, err
+	}
+	session := s.getSession(play.UserId)
+	if session == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no session for user %s", play.UserId)
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	if session.quarantined.Load() {
+		return nil, status.Errorf(codes.FailedPrecondition, "session for user %s is quarantined after a panic (rejoin to clear)", play.UserId)
+	}
+	length, start := session.enqueue(play)
+	if start {
+		go s.runQueue(session, play.TrackId)
+	}
+	log.Printf("EnqueueAudio %s queued on track %d for user %s (%d pending)",
+		play.RequestId, play.TrackId, play.UserId, length)
+	return &pb.EnqueueAudioResponse{Success: true, QueueLength: int32(length)}, nil
+}
+
+// GetQueue reports a track's pending entries and what the worker is
+// currently playing.
+func (s *LiveKitBridgeService) GetQueue(ctx context.Context, req *pb.GetQueueRequest) (*pb.GetQueueResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no session for user %s", req.UserId)
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	pending, playing := session.queueSnapshot(req.TrackId)
+	resp := &pb.GetQueueResponse{PlayingRequestId: playing}
+	for _, entry := range pending {
+		resp.Entries = append(resp.Entries, &pb.QueueEntry{
+			RequestId: entry.RequestId,
+			AudioUrl:  entry.AudioUrl,
+			AppId:     entry.AppId,
+		})
+	}
+	return resp, nil
+}
+
+// ClearQueue drops a track's pending entries. The entry currently
+// playing is not touched; stop it with StopAudio if needed.
+func (s *LiveKitBridgeService) ClearQueue(ctx context.Context, req *pb.ClearQueueRequest) (*pb.ClearQueueResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no session for user %s", req.UserId)
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	cleared := session.clearQueue(req.TrackId)
+	if cleared > 0 {
+		log.Printf("ClearQueue dropped %d pending entries on track %d for user %s",
+			cleared, req.TrackId, req.UserId)
+	}
+	return &pb.ClearQueueResponse{Success: true, Cleared: int32(cleared)}, nil
+}
+
+// runQueue drains one track's queue, playing entries back-to-back until
+// the queue empties or the session closes. The next entry decodes while
+// the current one plays, so consecutive clips join without a fetch gap.
+func (s *LiveKitBridgeService) runQueue(session *RoomSession, trackID int32) {
+	var pre *queuePrefetch
+	for {
+		req := session.nextQueued(trackID)
+		if req == nil {
+			return
+		}
+		// Best effort: entries enqueued after this point miss the
+		// prefetch window and fall back to fetching on their turn.
+		var nextPre *queuePrefetch
+		if next := session.peekQueued(trackID); next != nil && prefetchable(next) {
+			nextPre = s.startPrefetch(session, next)
+		}
+		if pre != nil && pre.requestID != req.RequestId {
+			pre = nil // queue changed under us (ClearQueue + re-enqueue)
+		}
+		s.playQueued(session, req, pre)
+		pre = nextPre
+	}
+}
+
+// prefetchable reports whether a queue entry is a plain decode-once
+// clip whose PCM can be prepared ahead of its turn. Live sources, raw
+// PCM, loops, items and bedded requests take the normal path.
+func prefetchable(req *pb.PlayAudioRequest) bool {
+	if req.AudioUrl == "" || len(req.Items) > 0 || req.SampleRate != 0 || req.BackgroundUrl != "" {
+		return false
+	}
+	if req.LoopCount > 1 || req.LoopForever {
+		return false
+	}
+	if isLiveSource(req.AudioUrl) {
+		return false
+	}
+	return true
+}
+
+// queuePrefetch is one entry's decode running ahead of its turn.
+type queuePrefetch struct {
+	requestID string
+	done      chan struct{}
+	pcm       []int16
+	err       error
+}
+
+func (s *LiveKitBridgeService) startPrefetch(session *RoomSession, req *pb.PlayAudioRequest) *queuePrefetch {
+	p := &queuePrefetch{requestID: req.RequestId, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		// The prefetch decodes to the cache's mono format; stereo
+		// entries take the normal fetch path when their turn comes.
+		if req.OutputChannels == 2 {
+			p.err = fmt.Errorf("stereo entry skips prefetch")
+			return
+		}
+		p.err = runProtected("queue prefetch "+req.RequestId, func() error {
+			pcm, err := s.fetchDecodedPCM(session.ctx, req.AudioUrl, req.Headers)
+			p.pcm = pcm
+			return err
+		})
+	}()
+	return p
+}
+
+// wait returns the decoded clip, or nil when there is no usable
+// prefetch (failed, or none started) and the caller should fetch
+// normally.
+func (p *queuePrefetch) wait(ctx context.Context) []int16 {
+	if p == nil {
+		return nil
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return nil
+	}
+	if p.err != nil {
+		log.Printf("queue prefetch %s: %v (falling back to normal fetch)", p.requestID, p.err)
+		return nil
+	}
+	return p.pcm
+}
+
+// playQueued runs one queue entry like a detached playback: policy
+// gated, usage accounted, terminal event recorded for GetPlaybackResult.
+func (s *LiveKitBridgeService) playQueued(session *RoomSession, req *pb.PlayAudioRequest, pre *queuePrefetch) {
+	who := req.RequestId + " (queued)"
+	if req.AppId != "" {
+		who = req.RequestId + " (queued, app " + req.AppId + ")"
+	}
+	code := s.policy.deny(req.UserId, req.AppId, time.Now())
+	if code == "" {
+		code = s.prefs.deny(req.UserId, session.tenant, time.Now())
+	}
+	if code != "" {
+		log.Printf("queued playback %s denied by policy (%s) for user %s", who, code, req.UserId)
+		s.results.store(req.UserId, req.RequestId, session.tenant, &pb.PlayAudioEvent{
+			Type:      pb.PlayAudioEvent_FAILED,
+			RequestId: req.RequestId,
+			Error:     "denied by audio policy",
+			Metadata:  map[string]string{"code": code},
+		})
+		return
+	}
+	req.Volume = s.policy.clampVolume(req.UserId, s.prefs.resolveVolume(req.UserId, session.tenant, req.Volume))
+
+	playCtx, playCancel := context.WithCancel(session.ctx)
+	defer playCancel()
+	preempted, err := session.beginPlayback(req.TrackId, req.RequestId, req.AppId, playCancel, s.config.MaxConcurrentPlaybacks, req.CrossfadeMs)
+	if err != nil {
+		log.Printf("queued playback %s rejected for user %s: %v", who, req.UserId, err)
+		s.results.store(req.UserId, req.RequestId, session.tenant, &pb.PlayAudioEvent{
+			Type:      pb.PlayAudioEvent_FAILED,
+			RequestId: req.RequestId,
+			Error:     err.Error(),
+		})
+		return
+	}
+	if preempted != "" {
+		log.Printf("queued playback %s preempts playback %s for user %s", who, preempted, req.UserId)
+	}
+	defer session.endPlayback(req.TrackId, req.RequestId)
+	s.results.markRunning(req.UserId, req.RequestId, session.tenant)
+	s.emitPlaybackStarted(session, req)
+
+	var durationMs int64
+	if pcm := pre.wait(playCtx); pcm != nil {
+		durationMs, err = s.playPrefetched(playCtx, session, req, pcm)
+	} else {
+		durationMs, err = s.runPlaybackProtected(playCtx, session, req)
+	}
+	s.policy.recordUsage(req.UserId, req.AppId, durationMs)
+	s.tenants.recordPlayback(session.tenant, durationMs)
+	s.results.store(req.UserId, req.RequestId, session.tenant, s.finishPlayback(session, req, who, durationMs, err))
+}
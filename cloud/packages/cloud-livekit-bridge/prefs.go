@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Per-user preferences: the durable counterpart of AudioPolicy. Policy
+// is pushed by the cloud on every JoinRoom and lives in memory only;
+// preferences are set once (by the user, through the cloud) and must
+// survive bridge restarts, so with BRIDGE_PREFS_FILE configured the
+// store snapshots to disk on every change — the same atomic tmp+rename
+// scheme as the UDP registration state, which keeps the binary free of
+// an embedded database.
+type prefsStore struct {
+	mu    sync.Mutex
+	path  string
+	prefs map[string]*prefsRecord
+}
+
+// prefsRecord pairs stored preferences with the tenant that wrote
+// them. Preferences are tenant-scoped like sessions: another tenant
+// can neither read them nor overwrite them, and they never shape a
+// session owned by a different tenant.
+type prefsRecord struct {
+	Tenant string              `json:"tenant"`
+	Prefs  *pb.UserPreferences `json:"prefs"`
+}
+
+func newPrefsStore(path string) *prefsStore {
+	p := &prefsStore{
+		path:  path,
+		prefs: make(map[string]*prefsRecord),
+	}
+	p.load()
+	return p
+}
+
+// load restores preferences from the snapshot file. A missing file is
+// normal (first start); anything else is logged and the store starts
+// empty.
+func (p *prefsStore) load() {
+	if p.path == "" {
+		return
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("load user preferences from %s: %v", p.path, err)
+		}
+		return
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		log.Printf("parse user preferences from %s: %v", p.path, err)
+		return
+	}
+	for userID, entry := range raw {
+		var rec prefsRecord
+		if err := json.Unmarshal(entry, &rec); err == nil && rec.Prefs != nil {
+			if rec.Tenant == "" {
+				rec.Tenant = defaultTenant
+			}
+			p.prefs[userID] = &rec
+			continue
+		}
+		// Pre-tenant snapshot: the value is the preferences themselves,
+		// adopted by the default tenant.
+		var legacy pb.UserPreferences
+		if err := json.Unmarshal(entry, &legacy); err == nil {
+			p.prefs[userID] = &prefsRecord{Tenant: defaultTenant, Prefs: &legacy}
+		}
+	}
+	log.Printf("restored preferences for %d users from %s", len(p.prefs), p.path)
+}
+
+// persistLocked snapshots the store to disk (atomic tmp+rename). No-op
+// when persistence is not configured; errors are logged rather than
+// failing the RPC. Caller holds mu.
+func (p *prefsStore) persistLocked() {
+	if p.path == "" {
+		return
+	}
+	data, err := json.Marshal(p.prefs)
+	if err != nil {
+		log.Printf("marshal user preferences: %v", err)
+		return
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("write user preferences to %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		log.Printf("rename user preferences to %s: %v", p.path, err)
+	}
+}
+
+// get returns the stored preferences for userID, rejecting callers
+// from a tenant other than the one that stored them.
+func (p *prefsStore) get(userID, tenant string) (*pb.UserPreferences, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rec := p.prefs[userID]
+	if rec == nil {
+		return nil, nil
+	}
+	if rec.Tenant != tenant {
+		return nil, status.Errorf(codes.PermissionDenied, "preferences for user %s belong to a different tenant", userID)
+	}
+	return rec.Prefs, nil
+}
+
+// set stores (or, with nil, clears) the preferences for userID. A
+// record owned by another tenant fails the write instead of being
+// silently replaced.
+func (p *prefsStore) set(userID, tenant string, prefs *pb.UserPreferences) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rec := p.prefs[userID]; rec != nil && rec.Tenant != tenant {
+		return status.Errorf(codes.PermissionDenied, "preferences for user %s belong to a different tenant", userID)
+	}
+	if prefs == nil {
+		delete(p.prefs, userID)
+	} else {
+		p.prefs[userID] = &prefsRecord{Tenant: tenant, Prefs: prefs}
+	}
+	p.persistLocked()
+	return nil
+}
+
+// lookup is the internal read on playback and session paths: the
+// tenant comes from the owning session, so a record written by another
+// tenant never shapes this tenant's audio.
+func (p *prefsStore) lookup(userID, tenant string) *pb.UserPreferences {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rec := p.prefs[userID]; rec != nil && rec.Tenant == tenant {
+		return rec.Prefs
+	}
+	return nil
+}
+
+// resolveVolume fills an omitted request volume from the user's default
+// before the policy ceiling applies.
+func (p *prefsStore) resolveVolume(userID, tenant string, v float32) float32 {
+	if v > 0 {
+		return v
+	}
+	if prefs := p.lookup(userID, tenant); prefs != nil && prefs.DefaultVolume > 0 {
+		return prefs.DefaultVolume
+	}
+	return volumeOrDefault(v)
+}
+
+// deny returns POLICY_QUIET_HOURS when the user's do-not-disturb window
+// covers now, mirroring the policy engine's quiet hours so apps see the
+// same denial code either way.
+func (p *prefsStore) deny(userID, tenant string, now time.Time) string {
+	prefs := p.lookup(userID, tenant)
+	if prefs == nil || !prefs.DndEnabled {
+		return ""
+	}
+	if inQuietWindow(prefs.DndStartMinutes, prefs.DndEndMinutes, prefs.UtcOffsetMinutes, now) {
+		return policyDenyQuietHours
+	}
+	return ""
+}
+
+// applyPreferences applies the session-scoped preferences (currently
+// the audio profile) to a freshly created session. Volume and DND are
+// resolved per playback instead, so preference changes take effect
+// without a rejoin.
+func (s *LiveKitBridgeService) applyPreferences(session *RoomSession) {
+	prefs := s.prefs.lookup(session.userID, session.tenant)
+	if prefs == nil {
+		return
+	}
+	if prefs.AudioProfile != "" {
+		profile, err := profileByName(prefs.AudioProfile)
+		if err != nil {
+			// Stored before the profile was removed: log and run default.
+			log.Printf("preferences for user %s: %v", session.userID, err)
+		} else if profile != nil {
+			session.outputProfile.Store(profile)
+			session.note("audio_profile", profile.name)
+		}
+	}
+}
+
+// GetUserPreferences returns the stored preferences for a user (unset
+// when none have been stored). Like the session RPCs, access is scoped
+// to the tenant that stored them.
+func (s *LiveKitBridgeService) GetUserPreferences(ctx context.Context, req *pb.GetUserPreferencesRequest) (*pb.GetUserPreferencesResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	prefs, err := s.prefs.get(req.UserId, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetUserPreferencesResponse{Preferences: prefs}, nil
+}
+
+// SetUserPreferences stores (or clears) a user's preferences and applies
+// the session-scoped ones to a live session immediately.
+func (s *LiveKitBridgeService) SetUserPreferences(ctx context.Context, req *pb.SetUserPreferencesRequest) (*pb.SetUserPreferencesResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if p := req.Preferences; p != nil {
+		if p.DndStartMinutes < 0 || p.DndStartMinutes >= 24*60 ||
+			p.DndEndMinutes < 0 || p.DndEndMinutes >= 24*60 {
+			return nil, status.Errorf(codes.InvalidArgument, "dnd window out of range")
+		}
+		if p.DefaultVolume < 0 || p.DefaultVolume > 1.0 {
+			return nil, status.Errorf(codes.InvalidArgument, "default_volume must be within [0.0, 1.0]")
+		}
+		if _, err := profileByName(p.AudioProfile); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		switch p.PreferredTransport {
+		case "", "livekit", "udp":
+		default:
+			return nil, status.Errorf(codes.InvalidArgument,
+				"unknown preferred_transport %q (supported: livekit, udp)", p.PreferredTransport)
+		}
+	}
+	if err := s.prefs.set(req.UserId, tenantFromContext(ctx), req.Preferences); err != nil {
+		return nil, err
+	}
+	if req.Preferences == nil {
+		log.Printf("preferences cleared for user %s", req.UserId)
+	} else {
+		log.Printf("preferences set for user %s (volume=%.2f, dnd=%v, transport=%q, profile=%q)",
+			req.UserId, req.Preferences.DefaultVolume, req.Preferences.DndEnabled,
+			req.Preferences.PreferredTransport, req.Preferences.AudioProfile)
+		if session := s.getSession(req.UserId); session != nil && s.checkTenant(ctx, session) == nil {
+			s.applyPreferences(session)
+		}
+	}
+	return &pb.SetUserPreferencesResponse{Success: true}, nil
+}
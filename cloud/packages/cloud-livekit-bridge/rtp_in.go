@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// RTP/RTSP ingest: PlayAudio accepts rtsp:// (pull, minimal RTSP client
+// speaking DESCRIBE/SETUP/PLAY) and rtp://host:port (bind and receive a
+// pushed feed) sources, so live intercoms and scanners can be piped to
+// the glasses. Only G.711 payloads (PCMU/PCMA) are accepted — the same
+// codec line SIP gear speaks — decoded, jitter-buffered, upsampled to
+// 16kHz, and written through the normal track path. Live feeds run
+// until cancelled and reconnect on errors.
+
+const (
+	rtpReadTimeout    = 5 * time.Second
+	rtpReconnectDelay = 2 * time.Second
+	rtpJitterDepth    = 4 // packets (~80ms of G.711) held for reordering
+	rtspKeepalive     = 30 * time.Second
+)
+
+// playRTPSource plays a live RTP/RTSP feed, reconnecting on failures
+// for as long as the request is not cancelled.
+func (s *LiveKitBridgeService) playRTPSource(ctx context.Context, session *RoomSession, req *pb.PlayAudioRequest) (int64, error) {
+	writer := s.newTrackWriter(session, req)
+	var played int64
+	for {
+		err := s.playRTPOnce(ctx, writer, req.AudioUrl, &played)
+		if ctx.Err() != nil {
+			return playedSamplesToMs(played), ctx.Err()
+		}
+		log.Printf("rtp source %s for request %s: %v, reconnecting in %s",
+			req.AudioUrl, req.RequestId, err, rtpReconnectDelay)
+		select {
+		case <-ctx.Done():
+			return playedSamplesToMs(played), ctx.Err()
+		case <-time.After(rtpReconnectDelay):
+		}
+	}
+}
+
+// playRTPOnce runs one connection attempt: set up the transport, then
+// receive until the feed stalls or the request is cancelled.
+func (s *LiveKitBridgeService) playRTPOnce(ctx context.Context, writer *trackWriter, rawURL string, played *int64) error {
+	var conn *net.UDPConn
+	var teardown func()
+	var err error
+	switch {
+	case strings.HasPrefix(rawURL, "rtsp://"):
+		conn, teardown, err = rtspSetup(ctx, rawURL)
+	case strings.HasPrefix(rawURL, "rtp://"):
+		conn, teardown, err = rtpListen(rawURL)
+	default:
+		return fmt.Errorf("unsupported rtp scheme in %q", rawURL)
+	}
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	jitter := newRTPJitterBuffer(rtpJitterDepth)
+	buf := make([]byte, 2048)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(rtpReadTimeout))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("rtp read: %w", err)
+		}
+		seq, pcm, err := parseRTPPacket(buf[:n])
+		if err != nil {
+			// Tolerate junk on the port (RTCP, probes); a bad payload
+			// type is fatal because the whole feed is the wrong codec.
+			if strings.Contains(err.Error(), "payload type") {
+				return err
+			}
+			continue
+		}
+		for _, frame := range jitter.push(seq, pcm) {
+			out := resampleLinear(frame, 8000, playbackSampleRate)
+			if err := writer.write(out); err != nil {
+				return fmt.Errorf("write sample: %w", err)
+			}
+			*played += int64(len(out))
+		}
+	}
+}
+
+// parseRTPPacket validates the header and decodes a G.711 payload to
+// 8kHz PCM.
+func parseRTPPacket(pkt []byte) (uint16, []int16, error) {
+	if len(pkt) < 12 || pkt[0]>>6 != 2 {
+		return 0, nil, fmt.Errorf("not an RTP packet")
+	}
+	payloadType := pkt[1] & 0x7F
+	var decode func(byte) int16
+	switch payloadType {
+	case 0:
+		decode = mulawDecode
+	case 8:
+		decode = alawDecode
+	default:
+		return 0, nil, fmt.Errorf("unsupported rtp payload type %d (want 0 pcmu or 8 pcma)", payloadType)
+	}
+	seq := binary.BigEndian.Uint16(pkt[2:4])
+	headerLen := 12 + 4*int(pkt[0]&0x0F) // fixed header + CSRCs
+	if pkt[0]&0x10 != 0 {                // extension header
+		if len(pkt) < headerLen+4 {
+			return 0, nil, fmt.Errorf("truncated rtp extension")
+		}
+		headerLen += 4 + 4*int(binary.BigEndian.Uint16(pkt[headerLen+2:headerLen+4]))
+	}
+	if len(pkt) < headerLen {
+		return 0, nil, fmt.Errorf("truncated rtp packet")
+	}
+	payload := pkt[headerLen:]
+	pcm := make([]int16, len(payload))
+	for i, b := range payload {
+		pcm[i] = decode(b)
+	}
+	return seq, pcm, nil
+}
+
+// rtpJitterBuffer reorders packets by sequence number. Frames come out
+// in order; a gap that outlives the buffer depth is conceded as loss
+// and replaced with one frame of silence so the feed keeps moving.
+type rtpJitterBuffer struct {
+	depth   int
+	pending map[uint16][]int16
+	next    uint16
+	started bool
+}
+
+func newRTPJitterBuffer(depth int) *rtpJitterBuffer {
+	return &rtpJitterBuffer{depth: depth, pending: make(map[uint16][]int16)}
+}
+
+func (j *rtpJitterBuffer) push(seq uint16, pcm []int16) [][]int16 {
+	if !j.started {
+		j.next = seq
+		j.started = true
+	}
+	j.pending[seq] = pcm
+	var out [][]int16
+	for {
+		if frame, ok := j.pending[j.next]; ok {
+			out = append(out, frame)
+			delete(j.pending, j.next)
+			j.next++
+			continue
+		}
+		if len(j.pending) > j.depth {
+			out = append(out, make([]int16, rtpFrameSamples))
+			j.next++
+			continue
+		}
+		return out
+	}
+}
+
+// rtpListen binds the local port named in an rtp://host:port URL to
+// receive a pushed feed.
+func rtpListen(rawURL string) (*net.UDPConn, func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rtp url: %w", err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, nil, fmt.Errorf("rtp url %q: port required", rawURL)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, nil, fmt.Errorf("rtp listen :%d: %w", port, err)
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
+// rtspSetup speaks just enough RTSP to pull a G.711 audio stream:
+// DESCRIBE for the SDP, SETUP with our UDP port, PLAY, and a keepalive
+// until teardown. TCP-interleaved transport is not supported.
+func rtspSetup(ctx context.Context, rawURL string) (*net.UDPConn, func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rtsp url: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+	tcp, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rtsp dial: %w", err)
+	}
+	udp, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		tcp.Close()
+		return nil, nil, fmt.Errorf("rtp bind: %w", err)
+	}
+	rtpPort := udp.LocalAddr().(*net.UDPAddr).Port
+
+	client := &rtspClient{conn: tcp, reader: bufio.NewReader(tcp)}
+	fail := func(err error) (*net.UDPConn, func(), error) {
+		tcp.Close()
+		udp.Close()
+		return nil, nil, err
+	}
+
+	_, sdp, err := client.request("DESCRIBE", rawURL, map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return fail(fmt.Errorf("rtsp describe: %w", err))
+	}
+	control, err := sdpAudioControl(sdp)
+	if err != nil {
+		return fail(err)
+	}
+	setupURL := rawURL
+	if control != "" && control != "*" {
+		if strings.Contains(control, "://") {
+			setupURL = control
+		} else {
+			setupURL = strings.TrimRight(rawURL, "/") + "/" + control
+		}
+	}
+	headers, _, err := client.request("SETUP", setupURL, map[string]string{
+		"Transport": fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", rtpPort, rtpPort+1),
+	})
+	if err != nil {
+		return fail(fmt.Errorf("rtsp setup: %w", err))
+	}
+	session, _, _ := strings.Cut(headers["session"], ";")
+	client.session = session
+	if _, _, err := client.request("PLAY", rawURL, map[string]string{"Range": "npt=0-"}); err != nil {
+		return fail(fmt.Errorf("rtsp play: %w", err))
+	}
+
+	// Keepalive so the server's session timeout (usually 60s) doesn't
+	// cut a healthy feed; errors surface via the RTP read timeout.
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(rtspKeepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				client.request("OPTIONS", rawURL, nil)
+			}
+		}
+	}()
+
+	teardown := func() {
+		close(stop)
+		client.request("TEARDOWN", rawURL, nil)
+		tcp.Close()
+		udp.Close()
+	}
+	return udp, teardown, nil
+}
+
+// rtspClient is the request/response half of the control connection.
+type rtspClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	cseq    int
+	session string
+}
+
+func (c *rtspClient) request(method, target string, headers map[string]string) (map[string]string, string, error) {
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, target, c.cseq)
+	if c.session != "" {
+		fmt.Fprintf(&b, "Session: %s\r\n", c.session)
+	}
+	for k, v := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("\r\n")
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return nil, "", err
+	}
+
+	statusLine, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, "", err
+	}
+	parts := strings.SplitN(strings.TrimSpace(statusLine), " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, "", fmt.Errorf("bad rtsp status line %q", strings.TrimSpace(statusLine))
+	}
+	if parts[1] != "200" {
+		return nil, "", fmt.Errorf("rtsp %s: status %s", method, parts[1])
+	}
+	resp := make(map[string]string)
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if key, val, ok := strings.Cut(line, ":"); ok {
+			resp[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+	}
+	var body string
+	if n, _ := strconv.Atoi(resp["content-length"]); n > 0 {
+		raw := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, raw); err != nil {
+			return nil, "", err
+		}
+		body = string(raw)
+	}
+	return resp, body, nil
+}
+
+// sdpAudioControl finds the G.711 audio media section and returns its
+// control attribute ("" if the session URL itself is the target).
+func sdpAudioControl(sdp string) (string, error) {
+	inAudio := false
+	control := ""
+	found := false
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			inAudio = false
+			// "m=audio <port> RTP/AVP <payload types...>"
+			if fields := strings.Fields(line); len(fields) >= 4 && fields[0] == "m=audio" {
+				for _, pt := range fields[3:] {
+					if pt == "0" || pt == "8" {
+						inAudio = true
+						found = true
+					}
+				}
+			}
+			continue
+		}
+		if inAudio && strings.HasPrefix(line, "a=control:") {
+			control = strings.TrimPrefix(line, "a=control:")
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("rtsp source has no G.711 audio stream (want payload 0 or 8)")
+	}
+	return control, nil
+}
+
+// mulawDecode expands G.711 µ-law back to linear PCM.
+func mulawDecode(b byte) int16 {
+	b = ^b
+	exp := (b >> 4) & 7
+	v := ((int(b&0x0F) << 3) + 0x84) << exp
+	v -= 0x84
+	if b&0x80 != 0 {
+		return int16(-v)
+	}
+	return int16(v)
+}
+
+// alawDecode expands G.711 A-law back to linear PCM.
+func alawDecode(b byte) int16 {
+	b ^= 0x55
+	exp := (b >> 4) & 7
+	mantissa := int(b & 0x0F)
+	var v int
+	if exp == 0 {
+		v = mantissa<<4 + 8
+	} else {
+		v = (mantissa + 16) << (exp + 3)
+	}
+	// Matches alawEncode's convention: bit 7 set = positive.
+	if b&0x80 == 0 {
+		v = -v
+	}
+	return int16(v)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// RTP mirror: everything written to one of the session's tracks is also
+// encoded as G.711 and sent to a configured UDP endpoint, so glasses
+// audio can be bridged into SIP/PBX conferencing without a media
+// gateway. G.711 is 8kHz, so the 16kHz track output is downsampled
+// before encoding; Opus payloads are rejected for the same pure-Go
+// build reason as everywhere else in this binary.
+
+// 20ms at 8kHz, the ptime every SIP stack expects for G.711.
+const rtpFrameSamples = 160
+
+// rtpSender packetizes PCM into G.711 RTP toward one UDP destination.
+type rtpSender struct {
+	conn    *net.UDPConn
+	trackID int32
+	payload uint8
+	encode  func(int16) byte
+	ssrc    uint32
+
+	mu  sync.Mutex
+	seq uint16
+	ts  uint32
+	buf []int16 // pending 8kHz samples, carried across blocks
+}
+
+func newRTPSender(address string, trackID int32, codec string) (*rtpSender, error) {
+	var payload uint8
+	var encode func(int16) byte
+	switch codec {
+	case "", "pcmu":
+		payload, encode = 0, mulawEncode
+	case "pcma":
+		payload, encode = 8, alawEncode
+	case "opus":
+		return nil, fmt.Errorf("opus RTP is not built into this binary (supported: pcmu, pcma)")
+	default:
+		return nil, fmt.Errorf("unknown rtp codec %q (supported: pcmu, pcma)", codec)
+	}
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("rtp address: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("rtp dial: %w", err)
+	}
+	return &rtpSender{
+		conn:    conn,
+		trackID: trackID,
+		payload: payload,
+		encode:  encode,
+		ssrc:    rand.Uint32(),
+		seq:     uint16(rand.Uint32()),
+	}, nil
+}
+
+// send mirrors a block of 16kHz mono track output. Send errors are
+// dropped silently: the mirror must never fail the playback or stream
+// write it rides on, and UDP to a dead PBX just blackholes anyway.
+func (r *rtpSender) send(samples []int16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, resampleLinear(samples, playbackSampleRate, 8000)...)
+	for len(r.buf) >= rtpFrameSamples {
+		pkt := make([]byte, 12+rtpFrameSamples)
+		pkt[0] = 0x80 // version 2
+		pkt[1] = r.payload
+		binary.BigEndian.PutUint16(pkt[2:4], r.seq)
+		binary.BigEndian.PutUint32(pkt[4:8], r.ts)
+		binary.BigEndian.PutUint32(pkt[8:12], r.ssrc)
+		for i := 0; i < rtpFrameSamples; i++ {
+			pkt[12+i] = r.encode(r.buf[i])
+		}
+		r.conn.Write(pkt)
+		r.seq++
+		r.ts += rtpFrameSamples
+		r.buf = r.buf[rtpFrameSamples:]
+	}
+}
+
+func (r *rtpSender) close() {
+	r.conn.Close()
+}
+
+// mirrorToRTP sends a processed block to the session's RTP mirror if
+// one is configured for this track.
+func (s *RoomSession) mirrorToRTP(trackID int32, samples []int16) {
+	if m := s.rtpMirror.Load(); m != nil && m.trackID == trackID {
+		m.send(samples)
+	}
+}
+
+// SetRtpMirror installs, replaces, or clears (empty address) the
+// session's RTP mirror.
+func (s *LiveKitBridgeService) SetRtpMirror(ctx context.Context, req *pb.SetRtpMirrorRequest) (*pb.SetRtpMirrorResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.SetRtpMirrorResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	if req.Address == "" {
+		if old := session.rtpMirror.Swap(nil); old != nil {
+			old.close()
+			log.Printf("rtp mirror cleared for user %s", req.UserId)
+		}
+		return &pb.SetRtpMirrorResponse{Success: true}, nil
+	}
+	sender, err := newRTPSender(req.Address, req.TrackId, req.Codec)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if old := session.rtpMirror.Swap(sender); old != nil {
+		old.close()
+	}
+	session.note("rtp_mirror", req.Address)
+	log.Printf("rtp mirror for user %s: track '%s' → %s (%s)",
+		req.UserId, trackName(req.TrackId), req.Address, rtpCodecName(req.Codec))
+	return &pb.SetRtpMirrorResponse{Success: true}, nil
+}
+
+func rtpCodecName(codec string) string {
+	if codec == "" {
+		return "pcmu"
+	}
+	return codec
+}
+
+// mulawEncode converts a linear sample to G.711 µ-law (ITU-T G.711).
+func mulawEncode(s int16) byte {
+	const bias = 0x84
+	sign := byte(0)
+	v := int(s)
+	if v < 0 {
+		v = -v
+		sign = 0x80
+	}
+	if v > 32635 {
+		v = 32635
+	}
+	v += bias
+	exp := 7
+	for mask := 0x4000; exp > 0 && v&mask == 0; mask >>= 1 {
+		exp--
+	}
+	mantissa := (v >> (exp + 3)) & 0x0F
+	return ^(sign | byte(exp<<4) | byte(mantissa))
+}
+
+// alawEncode converts a linear sample to G.711 A-law.
+func alawEncode(s int16) byte {
+	sign := byte(0x80)
+	v := int(s)
+	if v < 0 {
+		v = -v - 1
+		sign = 0
+	}
+	if v > 32635 {
+		v = 32635
+	}
+	var out byte
+	if v < 256 {
+		out = byte(v >> 4)
+	} else {
+		exp := 7
+		for mask := 0x4000; exp > 1 && v&mask == 0; mask >>= 1 {
+			exp--
+		}
+		mantissa := (v >> (exp + 3)) & 0x0F
+		out = byte((exp << 4) | mantissa)
+	}
+	return (sign | out) ^ 0x55
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// serverVersion is stamped by the build (-ldflags "-X main.serverVersion=...").
+var serverVersion = "dev"
+
+// instanceFeatures lists the optional capabilities of this build, reported
+// via GetInstanceInfo so placement can route around rolling deploys.
+var instanceFeatures = []string{
+	"udp_uplink",
+	"stereo_mixdown",
+	"stereo_tracks",
+	"subscribe_policy",
+	"watch_status",
+	"leave_linger",
+	"transcript_fanout",
+	"tenant_scoping",
+	"playback_queue",
+	"user_preferences",
+	"inline_playback",
+}
+
+// LiveKitBridgeService implements the LiveKitBridge gRPC service: room
+// lifecycle, bidirectional audio streaming, playback, and UDP registration.
+type LiveKitBridgeService struct {
+	pb.UnimplementedLiveKitBridgeServer
+
+	config      *Config
+	events      *eventHub
+	transcripts *transcriptHub
+	udp         *UdpAudioListener
+
+	// Decoded-PCM cache shared across sessions (nil when disabled)
+	audioCache *audioCache
+
+	// Shared HTTP client for PlayAudio fetches (DNS cache, idle conns)
+	audioHTTP *http.Client
+
+	// Per-user playback policy (quiet hours, app caps, volume ceiling)
+	policy *audioPolicyEngine
+
+	// Durable per-user preferences (default volume, DND, profile)
+	prefs *prefsStore
+
+	// Active background beds keyed by playback request ID
+	bedsMu sync.Mutex
+	beds   map[string]*bedMixer
+
+	// Terminal events of detached playbacks, for GetPlaybackResult
+	results *playbackResults
+
+	// Audit trail of state-changing RPCs, fed by the interceptors
+	audit *auditLog
+
+	// Per-tenant playback accounting (tenants come from request metadata)
+	tenants *tenantUsage
+
+	mu       sync.Mutex
+	sessions map[string]*RoomSession
+
+	// Per-user join locks: concurrent JoinRoom calls for the same user are
+	// serialized so the loser can't leak a live LiveKit connection.
+	// Entries are refcounted and dropped when the last holder releases,
+	// so the map doesn't grow with every user ID ever seen.
+	joinLocks map[string]*joinLock
+
+	activeStreams atomic.Int32
+	startTime     time.Time
+
+	// Snapshot from the previous HealthCheck, for the UDP packet rate
+	healthMu          sync.Mutex
+	lastHealthAt      time.Time
+	lastHealthPackets int64
+}
+
+// NewLiveKitBridgeService creates the service. The UDP listener is attached
+// separately by main (it may be disabled).
+func NewLiveKitBridgeService(config *Config) *LiveKitBridgeService {
+	s := &LiveKitBridgeService{
+		config:      config,
+		events:      newEventHub(),
+		transcripts: newTranscriptHub(),
+		sessions:    make(map[string]*RoomSession),
+		joinLocks:   make(map[string]*joinLock),
+		startTime:   time.Now(),
+		audioHTTP:   newAudioHTTPClient(config),
+		policy:      newAudioPolicyEngine(),
+		prefs:       newPrefsStore(config.PrefsFile),
+		beds:        make(map[string]*bedMixer),
+		results:     newPlaybackResults(),
+		audit:       newAuditLog(config),
+		tenants:     newTenantUsage(),
+	}
+	if config.AudioCacheMaxBytes > 0 {
+		s.audioCache = newAudioCache(config.AudioCacheMaxBytes, config.AudioCacheTTL)
+	}
+	if len(config.AudioPrewarmOrigins) > 0 {
+		prewarmAudioOrigins(s.audioHTTP, config.AudioPrewarmOrigins, config.AudioPrewarmInterval)
+	}
+	if config.LiveKitPrewarmURL != "" {
+		prewarmLiveKitHost(config.LiveKitPrewarmURL, config.LiveKitPrewarmInterval)
+	}
+	if config.SessionMetricsInterval > 0 {
+		superviseLoop("session metrics", func() { s.sessionMetricsLoop(config.SessionMetricsInterval) })
+	}
+	validateDSPConfig(config)
+	return s
+}
+
+// getSession returns the session for userID, or nil.
+func (s *LiveKitBridgeService) getSession(userID string) *RoomSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[userID]
+}
+
+// removeSession drops the session from the map if it is still the one given.
+func (s *LiveKitBridgeService) removeSession(session *RoomSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[session.userID] == session {
+		delete(s.sessions, session.userID)
+	}
+}
+
+// joinLock is one user's join mutex plus the number of holders waiting
+// on or owning it.
+type joinLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockJoin acquires the per-user mutex serializing JoinRoom calls and
+// returns the release func. The map entry lives only while someone
+// holds or waits on the lock; releasing the last reference deletes it.
+func (s *LiveKitBridgeService) lockJoin(userID string) func() {
+	s.mu.Lock()
+	lock := s.joinLocks[userID]
+	if lock == nil {
+		lock = &joinLock{}
+		s.joinLocks[userID] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		s.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.joinLocks, userID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// JoinRoom connects the bridge to the user's LiveKit room and starts
+// forwarding that room's DataChannel audio to the StreamAudio stream.
+func (s *LiveKitBridgeService) JoinRoom(ctx context.Context, req *pb.JoinRoomRequest) (*pb.JoinRoomResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if req.Token == "" || req.LivekitUrl == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "token and livekit_url required")
+	}
+
+	tenant := tenantFromContext(ctx)
+
+	// Serialize joins per user: two racing JoinRoom calls used to both
+	// connect, and the loser leaked a live LiveKit connection.
+	unlock := s.lockJoin(req.UserId)
+	defer unlock()
+
+	if old := s.getSession(req.UserId); old != nil {
+		if err := s.checkTenant(ctx, old); err != nil {
+			return nil, err
+		}
+		// A duplicate of an already-established join (same room, still
+		// connected) returns the winning session's info instead of
+		// tearing it down under the first caller.
+		if old.Connected() && old.roomName == req.RoomName && !old.quarantined.Load() {
+			old.cancelLinger()
+			log.Printf("JoinRoom: duplicate join for user %s room %s, reusing session", req.UserId, req.RoomName)
+			id, count := old.ParticipantInfo()
+			return &pb.JoinRoomResponse{
+				Success:          true,
+				ParticipantId:    id,
+				ParticipantCount: int32(count),
+				AffinityToken:    makeAffinityToken(s.config.InstanceID, req.UserId),
+			}, nil
+		}
+		log.Printf("JoinRoom: replacing existing session for user %s", req.UserId)
+		s.removeSession(old)
+		old.Close()
+	}
+
+	if s.config.TenantMaxSessions > 0 && s.tenantSessionCount(tenant) >= s.config.TenantMaxSessions {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"tenant %s session cap (%d) reached", tenant, s.config.TenantMaxSessions)
+	}
+
+	session := NewRoomSession(req.UserId, s.config.AudioChannelSize, s.events)
+	session.roomName = req.RoomName
+	session.tenant = tenant
+	session.joinReq = req
+	session.transcriptionHints = req.TranscriptionHints
+	if req.StereoMixdown {
+		session.stereoMix = newStereoMixer()
+	}
+	if s.config.WakeDetector != "" {
+		det, err := newWakeDetector(s.config.WakeDetector)
+		if err != nil {
+			// Config problem, not a join problem: log it and run without.
+			log.Printf("JoinRoom: %v", err)
+		} else {
+			session.wake = newSessionWake(det)
+		}
+	}
+	if s.config.SoundClassifier != "" {
+		cls, err := newSoundClassifier(s.config.SoundClassifier)
+		if err != nil {
+			log.Printf("JoinRoom: %v", err)
+		} else {
+			session.classify = newSessionClassifier(cls)
+		}
+	}
+	if s.config.GapConcealer != "" {
+		c, err := newGapConcealer(s.config.GapConcealer)
+		if err != nil {
+			log.Printf("JoinRoom: %v", err)
+		} else {
+			session.conceal = newSessionConcealer(c)
+		}
+	}
+	s.applyPreferences(session)
+
+	// The bridge joins with auto-subscribe off; subscribe_policy controls
+	// which remote audio publications it then subscribes to explicitly.
+	//
+	// Subscribed Opus tracks are not decoded in-process: this build is
+	// pure Go with no Opus decoder (see rejectOgg), so in-band FEC/PLC
+	// on lossy links can't be used here yet. Uplink loss is instead
+	// concealed at the frame level (BRIDGE_GAP_CONCEALER), with stats
+	// in GetStatus.
+	maybeSubscribe := func(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+		if pub.Kind() != lksdk.TrackKindAudio {
+			return
+		}
+		switch req.SubscribePolicy {
+		case pb.JoinRoomRequest_SUBSCRIBE_TARGET_AUDIO:
+			if req.TargetIdentity == "" || string(rp.Identity()) != req.TargetIdentity {
+				return
+			}
+		case pb.JoinRoomRequest_SUBSCRIBE_ALL_AUDIO:
+		default:
+			return
+		}
+		if err := pub.SetSubscribed(true); err != nil {
+			log.Printf("subscribe to track '%s' from %s failed for user %s: %v",
+				pub.Name(), rp.Identity(), req.UserId, err)
+			session.recordError("track", "subscribe '%s' from %s: %v", pub.Name(), rp.Identity(), err)
+		}
+	}
+
+	callback := &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackPublished: func(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				maybeSubscribe(pub, rp)
+			},
+			OnDataPacket: func(packet lksdk.DataPacket, params lksdk.DataReceiveParams) {
+				if req.TargetIdentity != "" && params.SenderIdentity != req.TargetIdentity {
+					return
+				}
+				user, ok := packet.(*lksdk.UserDataPacket)
+				if !ok {
+					return
+				}
+				session.forwardInbound(&inboundFrame{
+					pcm:            user.Payload,
+					senderIdentity: params.SenderIdentity,
+					trackName:      user.Topic,
+				}, s.config.LogEveryFrames)
+			},
+		},
+		OnParticipantConnected: func(rp *lksdk.RemoteParticipant) {
+			session.noteParticipant(string(rp.Identity()))
+			session.emit(pb.BridgeEvent_PARTICIPANT_JOINED, map[string]string{"identity": string(rp.Identity())})
+		},
+		OnParticipantDisconnected: func(rp *lksdk.RemoteParticipant) {
+			session.forgetParticipant(string(rp.Identity()))
+			session.emit(pb.BridgeEvent_PARTICIPANT_LEFT, map[string]string{"identity": string(rp.Identity())})
+		},
+		OnDisconnected: func() {
+			session.lastDisconnectAt.Store(time.Now().UnixMilli())
+			session.lastDisconnectReason.Store("room disconnected")
+			session.recordError("room", "room disconnected")
+			log.Printf("room disconnected for user %s", req.UserId)
+			session.emit(pb.BridgeEvent_ROOM_LEFT, map[string]string{"reason": "room disconnected"})
+		},
+	}
+
+	// DNS is probed separately before the connect (which also warms the
+	// cache for it); the SDK doesn't expose its websocket/ICE phases, so
+	// the rest is one connect figure.
+	timing := &pb.JoinTiming{}
+	if u, perr := url.Parse(req.LivekitUrl); perr == nil {
+		if host := u.Hostname(); host != "" && net.ParseIP(host) == nil {
+			dnsStart := time.Now()
+			if _, derr := net.DefaultResolver.LookupIPAddr(ctx, host); derr != nil {
+				log.Printf("JoinRoom: resolve %s for user %s: %v", host, req.UserId, derr)
+			}
+			timing.DnsMs = time.Since(dnsStart).Milliseconds()
+		}
+	}
+
+	connectStart := time.Now()
+	room, err := lksdk.ConnectToRoomWithToken(req.LivekitUrl, req.Token, callback, lksdk.WithAutoSubscribe(false))
+	if err != nil {
+		log.Printf("JoinRoom failed for user %s: %v", req.UserId, err)
+		return &pb.JoinRoomResponse{Success: false, Error: err.Error()}, nil
+	}
+	timing.ConnectMs = time.Since(connectStart).Milliseconds()
+	timing.TotalMs = timing.DnsMs + timing.ConnectMs
+	session.joinedAtMs.Store(time.Now().UnixMilli())
+
+	session.mu.Lock()
+	session.room = room
+	session.mu.Unlock()
+	for _, rp := range room.GetRemoteParticipants() {
+		session.noteParticipant(string(rp.Identity()))
+		for _, pub := range rp.TrackPublications() {
+			if remote, ok := pub.(*lksdk.RemoteTrackPublication); ok {
+				maybeSubscribe(remote, rp)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.sessions[req.UserId] = session
+	s.mu.Unlock()
+
+	participantID := string(room.LocalParticipant.Identity())
+	participantCount := int32(len(room.GetRemoteParticipants()) + 1)
+	log.Printf("joined room %s for user %s in %dms (dns=%dms connect=%dms participant=%s count=%d)",
+		req.RoomName, req.UserId, timing.TotalMs, timing.DnsMs, timing.ConnectMs, participantID, participantCount)
+	session.emit(pb.BridgeEvent_ROOM_JOINED, map[string]string{"room": req.RoomName})
+
+	return &pb.JoinRoomResponse{
+		Success:          true,
+		ParticipantId:    participantID,
+		ParticipantCount: participantCount,
+		AffinityToken:    makeAffinityToken(s.config.InstanceID, req.UserId),
+		JoinLatencyMs:    timing.ConnectMs,
+		Timing:           timing,
+	}, nil
+}
+
+// LeaveRoom tears down the user's session, or parks it for linger_ms so a
+// quick rejoin can reclaim the live room connection.
+func (s *LiveKitBridgeService) LeaveRoom(ctx context.Context, req *pb.LeaveRoomRequest) (*pb.LeaveRoomResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.LeaveRoomResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	if req.Reason != "" || req.ReasonCode != pb.LeaveRoomRequest_UNSPECIFIED {
+		log.Printf("LeaveRoom for user %s: code=%s reason=%q", req.UserId, req.ReasonCode, req.Reason)
+	}
+
+	if req.LingerMs > 0 && session.Connected() {
+		log.Printf("LeaveRoom: lingering session for user %s for %dms", req.UserId, req.LingerMs)
+		session.scheduleLinger(time.Duration(req.LingerMs)*time.Millisecond, func() {
+			// Take the join lock so the teardown can't race a rejoin
+			// that is reclaiming this session.
+			unlock := s.lockJoin(req.UserId)
+			defer unlock()
+			if s.getSession(req.UserId) != session {
+				return
+			}
+			log.Printf("linger expired for user %s, tearing down session", req.UserId)
+			s.removeSession(session)
+			session.Close()
+		})
+		return &pb.LeaveRoomResponse{Success: true}, nil
+	}
+
+	s.removeSession(session)
+	session.Close()
+	return &pb.LeaveRoomResponse{Success: true}, nil
+}
+
+// statusFor builds the status snapshot for one user.
+func (s *LiveKitBridgeService) statusFor(userID string) *pb.BridgeStatusResponse {
+	resp := &pb.BridgeStatusResponse{ServerVersion: serverVersion}
+	session := s.getSession(userID)
+	if session == nil {
+		return resp
+	}
+	resp.Connected = session.Connected()
+	id, count := session.ParticipantInfo()
+	resp.ParticipantId = id
+	resp.ParticipantCount = int32(count)
+	resp.LastDisconnectAt = session.lastDisconnectAt.Load()
+	if reason, ok := session.lastDisconnectReason.Load().(string); ok {
+		resp.LastDisconnectReason = reason
+	}
+	resp.Participants = session.participantRoster()
+	resp.RecentErrors = session.recentErrorLog()
+	if s.udp != nil {
+		resp.UdpPathAlive, resp.LastUdpPacketAt = s.udp.pathState(userID)
+	}
+	resp.ActiveTransport = session.transports.activeTransport()
+	resp.LivekitGaps = session.livekitGaps.proto()
+	resp.UdpGaps = session.udpGaps.proto()
+	resp.PlayingAppIds = session.playbackApps()
+	resp.DecodeCpuMs = session.decodeCPUMs()
+	resp.FramesConcealed = atomic.LoadInt64(&session.framesConcealed)
+	resp.TrackBufferMs = session.trackBufferMs()
+	return resp
+}
+
+// GetSessionTimeline returns the session's bounded event timeline.
+func (s *LiveKitBridgeService) GetSessionTimeline(ctx context.Context, req *pb.GetSessionTimelineRequest) (*pb.GetSessionTimelineResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return nil, status.Errorf(codes.NotFound, "no session for user %s", req.UserId)
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	return &pb.GetSessionTimelineResponse{Entries: session.timelineSnapshot()}, nil
+}
+
+// GetInstanceInfo reports identity, capacity and feature flags for the
+// cloud's placement logic.
+func (s *LiveKitBridgeService) GetInstanceInfo(ctx context.Context, req *pb.GetInstanceInfoRequest) (*pb.GetInstanceInfoResponse, error) {
+	s.mu.Lock()
+	active := len(s.sessions)
+	perTenant := make(map[string]int32)
+	for _, session := range s.sessions {
+		perTenant[session.tenant]++
+	}
+	s.mu.Unlock()
+
+	var tenants []*pb.TenantLoad
+	if len(s.config.TenantKeys) > 0 {
+		seen := make(map[string]bool)
+		for _, tenant := range s.config.TenantKeys {
+			if seen[tenant] {
+				continue
+			}
+			seen[tenant] = true
+			tenants = append(tenants, &pb.TenantLoad{
+				Tenant:         tenant,
+				ActiveSessions: perTenant[tenant],
+				PlaybackMs:     s.tenants.playbackMsFor(tenant),
+			})
+		}
+	}
+	return &pb.GetInstanceInfoResponse{
+		InstanceId:            s.config.InstanceID,
+		Region:                s.config.Region,
+		MaxSessions:           int32(s.config.MaxSessions),
+		ActiveSessions:        int32(active),
+		ActiveStreams:         s.activeStreams.Load(),
+		ServerVersion:         serverVersion,
+		Features:              instanceFeatures,
+		Tenants:               tenants,
+		SupportedAudioFormats: supportedPlaybackFormats,
+	}, nil
+}
+
+// ListSessions returns a status snapshot for every session on this
+// instance owned by the caller's tenant.
+func (s *LiveKitBridgeService) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	tenant := tenantFromContext(ctx)
+	s.mu.Lock()
+	sessions := make([]*RoomSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if session.tenant == tenant {
+			sessions = append(sessions, session)
+		}
+	}
+	s.mu.Unlock()
+
+	resp := &pb.ListSessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &pb.SessionEntry{
+			UserId:      session.userID,
+			Tenant:      tenant,
+			Status:      s.statusFor(session.userID),
+			DecodeCpuMs: session.decodeCPUMs(),
+		})
+	}
+	return resp, nil
+}
+
+// GetStatus reports room connectivity for one user session.
+func (s *LiveKitBridgeService) GetStatus(ctx context.Context, req *pb.BridgeStatusRequest) (*pb.BridgeStatusResponse, error) {
+	return s.statusFor(req.UserId), nil
+}
+
+// WatchStatus pushes a fresh status snapshot on every session state change
+// (room joined/left, disconnects, track publish/unpublish), starting with
+// one immediately, so the cloud can stop polling GetStatus.
+func (s *LiveKitBridgeService) WatchStatus(req *pb.BridgeStatusRequest, stream pb.LiveKitBridge_WatchStatusServer) error {
+	if req.UserId == "" {
+		return status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	id, ch := s.events.subscribe(req.UserId)
+	defer s.events.unsubscribe(id)
+
+	if err := stream.Send(s.statusFor(req.UserId)); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ch:
+			if err := stream.Send(s.statusFor(req.UserId)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// HealthCheck reports overall service health.
+func (s *LiveKitBridgeService) HealthCheck(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	s.mu.Lock()
+	active := len(s.sessions)
+	s.mu.Unlock()
+	resp := &pb.HealthCheckResponse{
+		Status:         pb.HealthCheckResponse_SERVING,
+		ActiveSessions: int32(active),
+		ActiveStreams:  s.activeStreams.Load(),
+		UptimeSeconds:  int64(time.Since(s.startTime).Seconds()),
+	}
+	if s.audioCache != nil {
+		resp.AudioCacheHits, resp.AudioCacheMisses, resp.AudioCacheBytes = s.audioCache.stats()
+	}
+	if s.udp != nil {
+		stats, err := s.GetUdpStats(ctx, &pb.GetUdpStatsRequest{})
+		if err == nil {
+			resp.Udp = stats
+			if stats.PacketsReceived > 0 {
+				resp.UdpDropRatio = float64(stats.PacketsDropped) / float64(stats.PacketsReceived)
+			}
+			s.healthMu.Lock()
+			now := time.Now()
+			if !s.lastHealthAt.IsZero() {
+				if dt := now.Sub(s.lastHealthAt).Seconds(); dt > 0 {
+					resp.UdpPacketRate = float64(stats.PacketsReceived-s.lastHealthPackets) / dt
+				}
+			}
+			s.lastHealthAt = now
+			s.lastHealthPackets = stats.PacketsReceived
+			s.healthMu.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// AnnounceShutdown publishes a SHUTTING_DOWN event for every session so
+// event subscribers can migrate users before streams are cut at deadline.
+func (s *LiveKitBridgeService) AnnounceShutdown(deadline time.Time) {
+	s.mu.Lock()
+	userIDs := make([]string, 0, len(s.sessions))
+	for userID := range s.sessions {
+		userIDs = append(userIDs, userID)
+	}
+	s.mu.Unlock()
+
+	attrs := map[string]string{
+		"drain_deadline_ms": strconv.FormatInt(deadline.UnixMilli(), 10),
+	}
+	for _, userID := range userIDs {
+		s.events.publish(&pb.BridgeEvent{
+			Type:        pb.BridgeEvent_SHUTTING_DOWN,
+			UserId:      userID,
+			TimestampMs: time.Now().UnixMilli(),
+			Attributes:  attrs,
+		})
+	}
+	log.Printf("announced shutdown to %d sessions (deadline %s)", len(userIDs), deadline.Format(time.RFC3339))
+}
+
+// CloseAll tears down every session (graceful shutdown).
+func (s *LiveKitBridgeService) CloseAll() {
+	s.mu.Lock()
+	sessions := make([]*RoomSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.sessions = make(map[string]*RoomSession)
+	s.mu.Unlock()
+	for _, session := range sessions {
+		session.Close()
+	}
+}
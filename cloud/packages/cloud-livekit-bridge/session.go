@@ -0,0 +1,1120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	lkmedia "github.com/livekit/server-sdk-go/v2/pkg/media"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Well-known track IDs (mirrors AudioChunk.track_id in the proto).
+// TrackIDEmergency is reserved for EmergencyBroadcast, so the alert can
+// play while the regular tracks sit paused underneath it.
+const (
+	TrackIDSpeaker   = 0
+	TrackIDAppAudio  = 1
+	TrackIDTTS       = 2
+	TrackIDEmergency = 9
+)
+
+// trackName maps a track ID to the LiveKit track name published to the room.
+func trackName(trackID int32) string {
+	switch trackID {
+	case TrackIDSpeaker:
+		return "speaker"
+	case TrackIDAppAudio:
+		return "app_audio"
+	case TrackIDTTS:
+		return "tts"
+	case TrackIDEmergency:
+		return "emergency"
+	default:
+		return fmt.Sprintf("app_track_%d", trackID)
+	}
+}
+
+// RoomSession is the per-user bridge state: one LiveKit room connection,
+// published PCM tracks keyed by track ID, and the channel carrying inbound
+// audio (LiveKit data packets / UDP uplink) toward the gRPC stream.
+type RoomSession struct {
+	userID   string
+	roomName string
+	tenant   string
+	joinedAt time.Time
+
+	// Opaque transcription hints from JoinRoom (language, vocabulary, app
+	// context). Immutable after join; read without locking.
+	transcriptionHints map[string]string
+
+	// Stereo diarization mixdown (JoinRoomRequest.stereo_mixdown), nil
+	// when disabled. Immutable after join.
+	stereoMix *stereoMixer
+
+	// Picks between LiveKit and UDP inbound audio, dropping the loser's
+	// frames during switchover.
+	transports *transportSelector
+
+	// Original join parameters, kept for ExportSession (contains the
+	// LiveKit token; never logged)
+	joinReq *pb.JoinRoomRequest
+
+	// Wake-word detector over inbound audio (nil when disabled)
+	wake *sessionWake
+
+	// Sound-event classifier over inbound audio (nil when disabled)
+	classify *sessionClassifier
+
+	// Uplink gap concealment: fills packet-loss holes before the audio
+	// reaches ASR (nil when disabled)
+	conceal *sessionConcealer
+
+	// Arrival-gap histograms per inbound transport (burstiness metrics)
+	livekitGaps gapHistogram
+	udpGaps     gapHistogram
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closeOnce   sync.Once
+	closed      atomic.Bool
+	quarantined atomic.Bool
+
+	mu     sync.Mutex
+	room   *lksdk.Room
+	tracks map[int32]*lkmedia.PCMLocalTrack
+
+	// Publish format of each live track, fixed at first publish
+	// (writers convert at the track boundary when it differs from the
+	// pipeline's mono playback rate).
+	trackFormats map[int32]trackFormat
+
+	// When the bridge first saw each remote participant (ms since epoch),
+	// keyed by identity. The SDK doesn't expose join times.
+	participantJoined map[string]int64
+
+	// Pending delayed teardown (LeaveRoomRequest.linger_ms), nil when the
+	// session is not lingering. Guarded by mu.
+	lingerTimer *time.Timer
+
+	// Inbound audio (room → TypeScript). Buffered; full channel drops
+	// frames instead of blocking the LiveKit callback goroutine.
+	audioFromLiveKit chan *inboundFrame
+
+	// Active playbacks keyed by track ID (at most one per track; the
+	// session-wide count is capped by Config.MaxConcurrentPlaybacks)
+	playbackMu sync.Mutex
+	playbacks  map[int32]*playbackHandle
+
+	// Tracks mid stop-fade: StopAudio ramps the last stopFadeDuration of
+	// audio to silence before cancelling, so the glasses don't click.
+	// Keyed by track ID, value is when the fade began. Guarded by
+	// playbackMu; allocated lazily.
+	stopFades map[int32]time.Time
+
+	// Tracks mid crossfade handoff (old playback ramping down into the
+	// sink, new playback mixing it back in). Guarded by playbackMu;
+	// allocated lazily.
+	crossfades map[int32]*crossfadeSink
+
+	// Latest bridge-side buffer depth sample per track, taken by the
+	// writer at each emit; GetStatus ages it by the sample time since
+	// the buffer drains in real time. Guarded by playbackMu; allocated
+	// lazily.
+	trackLeads map[int32]trackLeadSample
+
+	// Live per-track gain multipliers (SetTrackVolume); absent = unity.
+	// Guarded by playbackMu; allocated lazily.
+	trackGains map[int32]float32
+
+	// Per-track playback queues (EnqueueAudio). Guarded by queueMu;
+	// allocated lazily.
+	queueMu sync.Mutex
+	queues  map[int32]*trackQueue
+
+	// Output shaping profile for everything written to the session's
+	// tracks (nil = passthrough); swapped via SetAudioProfile
+	outputProfile atomic.Pointer[drcProfile]
+
+	// RTP mirror of one track's output toward a SIP/PBX endpoint
+	// (nil = disabled); swapped via SetRtpMirror
+	rtpMirror atomic.Pointer[rtpSender]
+
+	// Counters (atomics; read by GetStatus/HealthCheck)
+	framesForwarded int64
+	framesDropped   int64
+	framesConcealed int64
+	bytesForwarded  int64
+
+	// Playback samples written to tracks (mono-equivalent: stereo frames
+	// count once), for the session metrics output rate
+	samplesPlayed int64
+
+	// Mean absolute sample of the last inbound frame (admin UI level meter)
+	audioLevel atomic.Int64
+
+	// Cumulative time spent in this session's decode/DSP hot paths
+	// (nanos). Pacing waits are excluded, so it approximates CPU and
+	// singles out sessions fed pathological content.
+	decodeNanos atomic.Int64
+
+	// Disconnect bookkeeping for GetStatus
+	lastDisconnectAt     atomic.Int64
+	lastDisconnectReason atomic.Value // string
+
+	// Join-to-first-audio timing (ms since epoch): joinedAtMs is stamped
+	// when the room connect completes, firstInboundAt CAS-claimed by the
+	// first forwarded frame so the gap is logged exactly once.
+	joinedAtMs     atomic.Int64
+	firstInboundAt atomic.Int64
+
+	// Ring buffer of recent errors for GetStatus (newest last)
+	errMu        sync.Mutex
+	recentErrors []*pb.BridgeError
+
+	// Bounded event timeline for postmortems (oldest first)
+	timelineMu sync.Mutex
+	timeline   []*pb.TimelineEntry
+
+	events *eventHub
+}
+
+// NewRoomSession creates a session shell; the room is attached by JoinRoom.
+func NewRoomSession(userID string, chanSize int, events *eventHub) *RoomSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &RoomSession{
+		userID:            userID,
+		joinedAt:          time.Now(),
+		transports:        newTransportSelector(userID),
+		ctx:               ctx,
+		cancel:            cancel,
+		tracks:            make(map[int32]*lkmedia.PCMLocalTrack),
+		trackFormats:      make(map[int32]trackFormat),
+		playbacks:         make(map[int32]*playbackHandle),
+		participantJoined: make(map[string]int64),
+		audioFromLiveKit:  make(chan *inboundFrame, chanSize),
+		events:            events,
+	}
+	s.transports.onSwitch = func(from, to string) {
+		s.note("transport_switch", from+" -> "+to)
+	}
+	return s
+}
+
+// trackFormat is a published track's rate and channel layout. The zero
+// value means the pipeline default (playback rate, mono).
+type trackFormat struct {
+	rate     int
+	channels int
+}
+
+func (f trackFormat) withDefaults() trackFormat {
+	if f.rate == 0 {
+		f.rate = playbackSampleRate
+	}
+	if f.channels == 0 {
+		f.channels = playbackChannels
+	}
+	return f
+}
+
+// getOrCreateTrack returns the published PCM track for trackID and its
+// publish format, publishing a new track on first use. want picks the
+// format for that first use; an already-published track keeps its
+// format, so the returned format is what writers must convert to, not
+// necessarily what they asked for.
+func (s *RoomSession) getOrCreateTrack(trackID int32, want trackFormat) (*lkmedia.PCMLocalTrack, trackFormat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if track, ok := s.tracks[trackID]; ok {
+		return track, s.trackFormats[trackID], nil
+	}
+	if s.room == nil {
+		return nil, trackFormat{}, fmt.Errorf("no room for user %s", s.userID)
+	}
+	want = want.withDefaults()
+	track, err := lkmedia.NewPCMLocalTrack(want.rate, want.channels, nil)
+	if err != nil {
+		return nil, trackFormat{}, fmt.Errorf("new PCM track: %w", err)
+	}
+	name := trackName(trackID)
+	if _, err := s.room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{Name: name}); err != nil {
+		track.Close()
+		return nil, trackFormat{}, fmt.Errorf("publish track '%s': %w", name, err)
+	}
+	log.Printf("published track '%s' (%d Hz, %dch) for user %s", name, want.rate, want.channels, s.userID)
+	s.tracks[trackID] = track
+	s.trackFormats[trackID] = want
+	s.emit(pb.BridgeEvent_TRACK_PUBLISHED, map[string]string{"track": name})
+	return track, want, nil
+}
+
+// removeTrack closes and forgets the published track for trackID, so the
+// next write republishes a fresh one. Used after fatal write errors.
+func (s *RoomSession) removeTrack(trackID int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if track, ok := s.tracks[trackID]; ok {
+		track.Close()
+		delete(s.tracks, trackID)
+		delete(s.trackFormats, trackID)
+		log.Printf("unpublished track '%s' for user %s", trackName(trackID), s.userID)
+		s.emit(pb.BridgeEvent_TRACK_UNPUBLISHED, map[string]string{"track": trackName(trackID)})
+	}
+}
+
+// playbackHandle is one in-flight PlayAudio on a track. appID is the
+// third-party app the audio is attributed to (empty for system audio).
+type playbackHandle struct {
+	cancel    context.CancelFunc
+	requestID string
+	appID     string
+
+	// Pause gate: resume is non-nil while paused, and closing it
+	// releases the playback goroutine. pausedAt/pausedTotal extend the
+	// decode deadline so a pause can't trip PLAYBACK_TIMEOUT.
+	resume      chan struct{}
+	pausedAt    time.Time
+	pausedTotal time.Duration
+
+	// Closed when the playback's first samples reach the track, nil
+	// afterwards; the start-latency watchdog waits on it.
+	started chan struct{}
+
+	// Progress for PROGRESS events: samples emitted so far (accumulated
+	// across the writers a composite request creates) and the clip's
+	// expected duration when a decoder worked one out (0 = unknown).
+	playedSamples int64
+	expectedMs    int64
+}
+
+// release unblocks a paused playback so a cancelled context can be
+// observed. Caller holds playbackMu.
+func (h *playbackHandle) release() {
+	if h.resume != nil {
+		close(h.resume)
+		h.resume = nil
+	}
+}
+
+// beginPlayback registers a playback on trackID, preempting any playback
+// already on that track (hard cut, or a crossfade handoff when
+// crossfadeMs > 0). Returns the preempted request ID, or an error when
+// the session is at its concurrency cap (max <= 0 means unbounded).
+func (s *RoomSession) beginPlayback(trackID int32, requestID, appID string, cancel context.CancelFunc, max int, crossfadeMs int64) (string, error) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	var preempted string
+	if h, ok := s.playbacks[trackID]; ok {
+		if crossfadeMs > 0 {
+			s.beginCrossfade(trackID, h, crossfadeMs)
+		} else {
+			h.cancel()
+			h.release()
+		}
+		preempted = h.requestID
+		delete(s.playbacks, trackID)
+	}
+	if max > 0 && len(s.playbacks) >= max {
+		return "", fmt.Errorf("session at max concurrent playbacks (%d)", max)
+	}
+	// A new playback on the track must not inherit a still-running stop
+	// fade from its predecessor.
+	delete(s.stopFades, trackID)
+	s.playbacks[trackID] = &playbackHandle{
+		cancel:    cancel,
+		requestID: requestID,
+		appID:     appID,
+		started:   make(chan struct{}),
+	}
+	return preempted, nil
+}
+
+// firstWriteSignal returns a channel closed once the playback's first
+// samples reach the track, for start-latency budget enforcement. An
+// unknown or already-started playback gets an already-closed channel so
+// a watchdog never waits on a dead handle.
+func (s *RoomSession) firstWriteSignal(trackID int32, requestID string) <-chan struct{} {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if h, ok := s.playbacks[trackID]; ok && h.requestID == requestID && h.started != nil {
+		return h.started
+	}
+	closed := make(chan struct{})
+	close(closed)
+	return closed
+}
+
+// noteFirstWrite marks the playback's first samples as written,
+// releasing its start-latency watchdog. Idempotent across the writers a
+// composite or looped request creates: only the first write counts.
+func (s *RoomSession) noteFirstWrite(trackID int32, requestID string) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if h, ok := s.playbacks[trackID]; ok && h.requestID == requestID && h.started != nil {
+		close(h.started)
+		h.started = nil
+	}
+}
+
+// playbackApps lists the app IDs currently playing audio on the session,
+// for "something keeps beeping" attribution.
+func (s *RoomSession) playbackApps() []string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	var apps []string
+	for _, h := range s.playbacks {
+		if h.appID != "" {
+			apps = append(apps, h.appID)
+		}
+	}
+	return apps
+}
+
+// endPlayback deregisters a finished playback if it still owns the track.
+func (s *RoomSession) endPlayback(trackID int32, requestID string) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if h, ok := s.playbacks[trackID]; ok && h.requestID == requestID {
+		delete(s.playbacks, trackID)
+	}
+	delete(s.stopFades, trackID)
+	delete(s.trackLeads, trackID)
+	// Drop a crossfade sink the finished playback was party to; a sink
+	// between two other requests stays.
+	if x, ok := s.crossfades[trackID]; ok && x.from == requestID {
+		delete(s.crossfades, trackID)
+	}
+}
+
+// notePlaybackProgress accumulates emitted samples (and the decoder's
+// expected clip duration, once known) onto the playback's handle, so
+// the PROGRESS emitter reads position without touching the writer.
+func (s *RoomSession) notePlaybackProgress(trackID int32, requestID string, samples, expectedMs int64) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if h, ok := s.playbacks[trackID]; ok && h.requestID == requestID {
+		h.playedSamples += samples
+		if expectedMs > 0 {
+			h.expectedMs = expectedMs
+		}
+	}
+}
+
+// playbackProgress reports a playback's position and expected duration
+// (0 = unknown) for PROGRESS events; ok is false once it has ended.
+func (s *RoomSession) playbackProgress(trackID int32, requestID string) (positionMs, durationMs int64, ok bool) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	h, found := s.playbacks[trackID]
+	if !found || h.requestID != requestID {
+		return 0, 0, false
+	}
+	return playedSamplesToMs(h.playedSamples), h.expectedMs, true
+}
+
+// trackLeadSample is one buffer-depth observation: how much audio was
+// queued ahead of real time, and when that was measured.
+type trackLeadSample struct {
+	queued time.Duration
+	at     time.Time
+}
+
+// noteTrackLead records how much decoded audio the writer has pushed
+// ahead of real time on a track.
+func (s *RoomSession) noteTrackLead(trackID int32, queued time.Duration) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if s.trackLeads == nil {
+		s.trackLeads = make(map[int32]trackLeadSample)
+	}
+	s.trackLeads[trackID] = trackLeadSample{queued: queued, at: time.Now()}
+}
+
+// trackBufferMs reports the bridge-side playback buffer depth per track
+// for GetStatus, aging each sample by the time since it was taken (the
+// queued audio drains in real time once the writer stops).
+func (s *RoomSession) trackBufferMs() map[int32]int64 {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if len(s.trackLeads) == 0 {
+		return nil
+	}
+	out := make(map[int32]int64, len(s.trackLeads))
+	for id, sample := range s.trackLeads {
+		left := sample.queued - time.Since(sample.at)
+		if left < 0 {
+			left = 0
+		}
+		out[id] = left.Milliseconds()
+	}
+	return out
+}
+
+// setTrackGain installs a live gain multiplier for a track's output
+// (1 removes the entry: unity is the default).
+func (s *RoomSession) setTrackGain(trackID int32, gain float32) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if gain == 1 {
+		delete(s.trackGains, trackID)
+		return
+	}
+	if s.trackGains == nil {
+		s.trackGains = make(map[int32]float32)
+	}
+	s.trackGains[trackID] = gain
+}
+
+// trackGain returns the track's live gain multiplier (1 = unity).
+func (s *RoomSession) trackGain(trackID int32) float64 {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if g, ok := s.trackGains[trackID]; ok {
+		return float64(g)
+	}
+	return 1
+}
+
+// stopPlayback stops every active playback with the anti-click fade,
+// returning their request IDs.
+func (s *RoomSession) stopPlayback() []string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	var stopped []string
+	for trackID, h := range s.playbacks {
+		s.beginStopFade(trackID, h)
+		stopped = append(stopped, h.requestID)
+		delete(s.playbacks, trackID)
+	}
+	return stopped
+}
+
+// stopPlaybackTrack stops the active playback on one track with the
+// anti-click fade, returning its request ID (empty if the track is idle).
+func (s *RoomSession) stopPlaybackTrack(trackID int32) string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	h, ok := s.playbacks[trackID]
+	if !ok {
+		return ""
+	}
+	s.beginStopFade(trackID, h)
+	delete(s.playbacks, trackID)
+	return h.requestID
+}
+
+// stopPlaybackRequest cancels the playback with requestID, if active.
+// Returns the request ID stopped (empty if not found).
+func (s *RoomSession) stopPlaybackRequest(requestID string) string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	for trackID, h := range s.playbacks {
+		if h.requestID == requestID {
+			s.beginStopFade(trackID, h)
+			delete(s.playbacks, trackID)
+			return requestID
+		}
+	}
+	return ""
+}
+
+// beginStopFade starts the anti-click stop for a playback: the track
+// writer ramps the next stopFadeDuration of audio to silence, and the
+// playback context is cancelled once the ramp has run out. Caller
+// holds playbackMu.
+func (s *RoomSession) beginStopFade(trackID int32, h *playbackHandle) {
+	if s.stopFades == nil {
+		s.stopFades = make(map[int32]time.Time)
+	}
+	s.stopFades[trackID] = time.Now()
+	h.release()
+	time.AfterFunc(stopFadeDuration, h.cancel)
+}
+
+// stopFadeStart reports when the track's stop fade began, if one is
+// running.
+func (s *RoomSession) stopFadeStart(trackID int32) (time.Time, bool) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	start, ok := s.stopFades[trackID]
+	return start, ok
+}
+
+// beginCrossfade hands the track from the outgoing playback to its
+// successor: the outgoing writer ramps into the sink for crossfadeMs
+// while the incoming writer mixes it back under its own audio. The
+// outgoing decode is cancelled once the window has elapsed. Caller
+// holds playbackMu.
+func (s *RoomSession) beginCrossfade(trackID int32, h *playbackHandle, crossfadeMs int64) {
+	if s.crossfades == nil {
+		s.crossfades = make(map[int32]*crossfadeSink)
+	}
+	s.crossfades[trackID] = &crossfadeSink{
+		from:  h.requestID,
+		total: int(crossfadeMs) * playbackSampleRate / 1000,
+	}
+	h.release()
+	time.AfterFunc(time.Duration(crossfadeMs)*time.Millisecond, h.cancel)
+}
+
+// crossfadeFor returns the track's active crossfade sink, if any.
+func (s *RoomSession) crossfadeFor(trackID int32) *crossfadeSink {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	return s.crossfades[trackID]
+}
+
+// clearCrossfade removes a spent sink, unless the track has already
+// moved on to a newer one.
+func (s *RoomSession) clearCrossfade(trackID int32, x *crossfadeSink) {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if s.crossfades[trackID] == x {
+		delete(s.crossfades, trackID)
+	}
+}
+
+// pausePlayback pauses the playback on trackID in place. Returns the
+// playback's request ID ("" when the track is idle); pausing an
+// already-paused playback is a no-op.
+func (s *RoomSession) pausePlayback(trackID int32) string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	h, ok := s.playbacks[trackID]
+	if !ok {
+		return ""
+	}
+	if h.resume == nil {
+		h.resume = make(chan struct{})
+		h.pausedAt = time.Now()
+	}
+	return h.requestID
+}
+
+// pauseAll pauses every active playback, returning the track IDs that
+// were newly paused. Already-paused tracks are left alone so resuming
+// the batch can't release a pause some other caller still holds.
+func (s *RoomSession) pauseAll() []int32 {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	var paused []int32
+	for trackID, h := range s.playbacks {
+		if h.resume == nil {
+			h.resume = make(chan struct{})
+			h.pausedAt = time.Now()
+			paused = append(paused, trackID)
+		}
+	}
+	return paused
+}
+
+// resumePlayback releases a paused playback on trackID. Returns the
+// playback's request ID ("" when the track is idle); resuming a
+// playback that isn't paused is a no-op.
+func (s *RoomSession) resumePlayback(trackID int32) string {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	h, ok := s.playbacks[trackID]
+	if !ok {
+		return ""
+	}
+	if h.resume != nil {
+		h.pausedTotal += time.Since(h.pausedAt)
+		h.release()
+	}
+	return h.requestID
+}
+
+// pauseGate returns the channel the playback goroutine must wait on, or
+// nil when the track's playback is not paused.
+func (s *RoomSession) pauseGate(trackID int32) <-chan struct{} {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	if h, ok := s.playbacks[trackID]; ok && h.resume != nil {
+		return h.resume
+	}
+	return nil
+}
+
+// pausedExtra reports how long the track's playback has spent paused,
+// for extending duration-derived decode deadlines.
+func (s *RoomSession) pausedExtra(trackID int32) time.Duration {
+	s.playbackMu.Lock()
+	defer s.playbackMu.Unlock()
+	h, ok := s.playbacks[trackID]
+	if !ok {
+		return 0
+	}
+	total := h.pausedTotal
+	if h.resume != nil {
+		total += time.Since(h.pausedAt)
+	}
+	return total
+}
+
+// inboundFrame is one chunk of inbound audio with its source labels, so
+// multiple bridged senders stay separable for per-speaker transcription.
+type inboundFrame struct {
+	pcm            []byte
+	senderIdentity string
+	trackName      string
+	channels       int // 0 or 1 = mono, 2 = stereo mixdown
+}
+
+// forwardInbound pushes inbound room/UDP audio toward the gRPC stream.
+// A full channel drops the frame instead of blocking the caller (the
+// LiveKit callback goroutine or the UDP read loop).
+//
+// The channel is never closed: LiveKit keeps delivering OnDataPacket
+// callbacks for a short window after room.Disconnect(), and a send on a
+// closed channel would panic the whole process (see the giga-lag
+// postmortem). Instead Close() flips the closed flag and cancels ctx;
+// late packets are dropped here.
+func (s *RoomSession) forwardInbound(frame *inboundFrame, logEvery int) {
+	// The caller is an SDK-owned goroutine we can't supervise; a panic
+	// here must not take the process down with it.
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic("inbound forward", r)
+			s.quarantine(fmt.Sprintf("panic in inbound forward: %v", r))
+		}
+	}()
+	if s.closed.Load() {
+		atomic.AddInt64(&s.framesDropped, 1)
+		return
+	}
+	now := time.Now()
+	transport := transportLiveKit
+	if frame.trackName == "udp" {
+		transport = transportUDP
+		s.udpGaps.observe(now)
+	} else {
+		s.livekitGaps.observe(now)
+	}
+	if !s.transports.admit(transport, now) {
+		atomic.AddInt64(&s.framesDropped, 1)
+		return
+	}
+	s.audioLevel.Store(pcmAvgAbs(frame.pcm))
+	if s.firstInboundAt.CompareAndSwap(0, now.UnixMilli()) {
+		if joined := s.joinedAtMs.Load(); joined > 0 {
+			ms := now.UnixMilli() - joined
+			log.Printf("first inbound audio for user %s %dms after join (%s)", s.userID, ms, frame.trackName)
+			s.note("first_inbound", fmt.Sprintf("%dms after join via %s", ms, frame.trackName))
+		}
+	}
+	if s.wake != nil && s.wake.observe(frame.pcm, now) {
+		log.Printf("wake detected for user %s (%s)", s.userID, s.wake.det.name())
+		s.emit(pb.BridgeEvent_WAKE_DETECTED, map[string]string{
+			"detector": s.wake.det.name(),
+			"source":   frame.trackName,
+		})
+	}
+	if s.classify != nil {
+		for _, label := range s.classify.observe(frame.pcm, now) {
+			log.Printf("sound event %q for user %s (%s)", label, s.userID, s.classify.cls.name())
+			s.emit(pb.BridgeEvent_SOUND_DETECTED, map[string]string{
+				"label":      label,
+				"classifier": s.classify.cls.name(),
+				"source":     frame.trackName,
+			})
+		}
+	}
+	if s.stereoMix != nil {
+		frame = s.stereoMix.render(frame)
+	}
+	if s.conceal != nil {
+		if fill := s.conceal.observe(frame.pcm, now); len(fill) > 0 {
+			// Fill goes ahead of the frame that revealed the hole; if
+			// the channel is full the hole stays a hole.
+			select {
+			case s.audioFromLiveKit <- &inboundFrame{
+				pcm:            fill,
+				senderIdentity: frame.senderIdentity,
+				trackName:      frame.trackName,
+				channels:       frame.channels,
+			}:
+				atomic.AddInt64(&s.framesConcealed, 1)
+			default:
+			}
+		}
+	}
+	pcm := frame.pcm
+	select {
+	case <-s.ctx.Done():
+		atomic.AddInt64(&s.framesDropped, 1)
+	case s.audioFromLiveKit <- frame:
+		n := atomic.AddInt64(&s.framesForwarded, 1)
+		atomic.AddInt64(&s.bytesForwarded, int64(len(pcm)))
+		if logEvery > 0 && n%int64(logEvery) == 0 {
+			log.Printf("forwarded %d frames for user %s (dropped=%d, concealed=%d)",
+				n, s.userID, atomic.LoadInt64(&s.framesDropped), atomic.LoadInt64(&s.framesConcealed))
+		}
+	default:
+		atomic.AddInt64(&s.framesDropped, 1)
+	}
+}
+
+// emit publishes a session lifecycle event to SubscribeEvents consumers
+// and records it on the session timeline.
+func (s *RoomSession) emit(evType pb.BridgeEvent_EventType, attrs map[string]string) {
+	detail := ""
+	for _, key := range []string{"room", "identity", "track", "request_id", "reason", "error"} {
+		if v := attrs[key]; v != "" {
+			detail = v
+			break
+		}
+	}
+	s.note(strings.ToLower(evType.String()), detail)
+	if s.events == nil {
+		return
+	}
+	s.events.publish(&pb.BridgeEvent{
+		Type:               evType,
+		UserId:             s.userID,
+		TimestampMs:        time.Now().UnixMilli(),
+		Attributes:         attrs,
+		TranscriptionHints: s.transcriptionHints,
+	})
+}
+
+// errorLogSize bounds the per-session error ring buffer.
+const errorLogSize = 16
+
+// timelineSize bounds the per-session event timeline.
+const timelineSize = 64
+
+// note appends an entry to the session timeline, dropping the oldest
+// entry when full.
+func (s *RoomSession) note(kind, detail string) {
+	s.timelineMu.Lock()
+	defer s.timelineMu.Unlock()
+	if len(s.timeline) >= timelineSize {
+		s.timeline = s.timeline[1:]
+	}
+	s.timeline = append(s.timeline, &pb.TimelineEntry{
+		TimestampMs: time.Now().UnixMilli(),
+		Kind:        kind,
+		Detail:      detail,
+	})
+}
+
+// timelineSnapshot copies the timeline for the admin RPC.
+func (s *RoomSession) timelineSnapshot() []*pb.TimelineEntry {
+	s.timelineMu.Lock()
+	defer s.timelineMu.Unlock()
+	out := make([]*pb.TimelineEntry, len(s.timeline))
+	copy(out, s.timeline)
+	return out
+}
+
+// recordError appends an error to the session's ring buffer, dropping the
+// oldest entry when full. Scope labels the subsystem ("room", "playback",
+// "stream", "track").
+func (s *RoomSession) recordError(scope, format string, args ...interface{}) {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if len(s.recentErrors) >= errorLogSize {
+		s.recentErrors = s.recentErrors[1:]
+	}
+	msg := fmt.Sprintf(format, args...)
+	s.recentErrors = append(s.recentErrors, &pb.BridgeError{
+		TimestampMs: time.Now().UnixMilli(),
+		Scope:       scope,
+		Message:     msg,
+	})
+	s.note("error", scope+": "+msg)
+}
+
+// trackList names the currently published tracks, for the admin UI.
+func (s *RoomSession) trackList() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for id := range s.tracks {
+		names = append(names, trackName(id))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pcmAvgAbs is the mean absolute sample of little-endian 16-bit PCM,
+// the admin UI's cheap level meter.
+func pcmAvgAbs(pcm []byte) int64 {
+	n := len(pcm) / 2
+	if n == 0 {
+		return 0
+	}
+	var sum int64
+	for i := 0; i < n; i++ {
+		v := int64(int16(uint16(pcm[2*i]) | uint16(pcm[2*i+1])<<8))
+		if v < 0 {
+			v = -v
+		}
+		sum += v
+	}
+	return sum / int64(n)
+}
+
+// enqueue appends a queued playback, reporting the pending length and
+// whether the caller should start the track's worker.
+func (s *RoomSession) enqueue(req *pb.PlayAudioRequest) (int, bool) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if s.queues == nil {
+		s.queues = make(map[int32]*trackQueue)
+	}
+	q := s.queues[req.TrackId]
+	if q == nil {
+		q = &trackQueue{}
+		s.queues[req.TrackId] = q
+	}
+	q.pending = append(q.pending, req)
+	start := !q.active
+	if start {
+		q.active = true
+	}
+	return len(q.pending), start
+}
+
+// nextQueued pops the next entry for the queue worker, or nil (worker
+// exits) when the queue is empty or the session is closing.
+func (s *RoomSession) nextQueued(trackID int32) *pb.PlayAudioRequest {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	q := s.queues[trackID]
+	if q == nil {
+		return nil
+	}
+	if len(q.pending) == 0 || s.ctx.Err() != nil {
+		q.active = false
+		q.playing = ""
+		return nil
+	}
+	req := q.pending[0]
+	q.pending = q.pending[1:]
+	q.playing = req.RequestId
+	return req
+}
+
+// peekQueued returns the entry the queue worker will play next, if any.
+func (s *RoomSession) peekQueued(trackID int32) *pb.PlayAudioRequest {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if q := s.queues[trackID]; q != nil && len(q.pending) > 0 {
+		return q.pending[0]
+	}
+	return nil
+}
+
+// queueSnapshot returns the pending entries in play order and the
+// request the worker is currently on.
+func (s *RoomSession) queueSnapshot(trackID int32) ([]*pb.PlayAudioRequest, string) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	q := s.queues[trackID]
+	if q == nil {
+		return nil, ""
+	}
+	return append([]*pb.PlayAudioRequest(nil), q.pending...), q.playing
+}
+
+// exportQueues snapshots every track's pending entries for session
+// export. The entry currently playing is not included; it finishes (or
+// dies) with this instance.
+func (s *RoomSession) exportQueues() map[int32][]*pb.PlayAudioRequest {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	var out map[int32][]*pb.PlayAudioRequest
+	for trackID, q := range s.queues {
+		if len(q.pending) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[int32][]*pb.PlayAudioRequest)
+		}
+		out[trackID] = append([]*pb.PlayAudioRequest(nil), q.pending...)
+	}
+	return out
+}
+
+// exportTrackFormats snapshots the published tracks' formats for
+// session export.
+func (s *RoomSession) exportTrackFormats() map[int32]trackFormat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out map[int32]trackFormat
+	for trackID, f := range s.trackFormats {
+		if out == nil {
+			out = make(map[int32]trackFormat)
+		}
+		out[trackID] = f
+	}
+	return out
+}
+
+// clearQueue drops a track's pending entries, reporting how many.
+func (s *RoomSession) clearQueue(trackID int32) int {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	q := s.queues[trackID]
+	if q == nil {
+		return 0
+	}
+	n := len(q.pending)
+	q.pending = nil
+	return n
+}
+
+// chargeDecode attributes a completed decode/DSP section to the session.
+func (s *RoomSession) chargeDecode(start time.Time) {
+	s.decodeNanos.Add(int64(time.Since(start)))
+}
+
+// decodeCPUMs is the session's total attributed decode/DSP time.
+func (s *RoomSession) decodeCPUMs() int64 {
+	return s.decodeNanos.Load() / int64(time.Millisecond)
+}
+
+// quarantine marks the session so new playbacks are refused until the
+// user rejoins. Set after a panic in one of the session's workers: the
+// input that tripped it tends to come right back.
+func (s *RoomSession) quarantine(reason string) {
+	if s.quarantined.CompareAndSwap(false, true) {
+		log.Printf("session for user %s quarantined: %s", s.userID, reason)
+		s.recordError("panic", "%s", reason)
+	}
+}
+
+// recentErrorLog snapshots the error ring buffer for GetStatus.
+func (s *RoomSession) recentErrorLog() []*pb.BridgeError {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	out := make([]*pb.BridgeError, len(s.recentErrors))
+	copy(out, s.recentErrors)
+	return out
+}
+
+// noteParticipant records when a remote participant was first seen.
+func (s *RoomSession) noteParticipant(identity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.participantJoined[identity]; !ok {
+		s.participantJoined[identity] = time.Now().UnixMilli()
+	}
+}
+
+// forgetParticipant drops the first-seen record for identity.
+func (s *RoomSession) forgetParticipant(identity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.participantJoined, identity)
+}
+
+// participantRoster snapshots the remote participants for GetStatus.
+func (s *RoomSession) participantRoster() []*pb.RoomParticipant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.room == nil {
+		return nil
+	}
+	var roster []*pb.RoomParticipant
+	for _, rp := range s.room.GetRemoteParticipants() {
+		identity := string(rp.Identity())
+		publishing := false
+		for _, pub := range rp.TrackPublications() {
+			if pub.Kind() == lksdk.TrackKindAudio {
+				publishing = true
+				break
+			}
+		}
+		roster = append(roster, &pb.RoomParticipant{
+			Identity:        identity,
+			JoinedAtMs:      s.participantJoined[identity],
+			PublishingAudio: publishing,
+		})
+	}
+	return roster
+}
+
+// scheduleLinger arms (or re-arms) the delayed teardown timer.
+func (s *RoomSession) scheduleLinger(d time.Duration, teardown func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lingerTimer != nil {
+		s.lingerTimer.Stop()
+	}
+	s.lingerTimer = time.AfterFunc(d, teardown)
+}
+
+// cancelLinger disarms a pending delayed teardown (quick rejoin).
+func (s *RoomSession) cancelLinger() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lingerTimer != nil {
+		s.lingerTimer.Stop()
+		s.lingerTimer = nil
+	}
+}
+
+// Connected reports whether the session currently has a live room.
+func (s *RoomSession) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.room != nil
+}
+
+// ParticipantInfo returns the local participant identity and room size.
+func (s *RoomSession) ParticipantInfo() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.room == nil {
+		return "", 0
+	}
+	return string(s.room.LocalParticipant.Identity()), len(s.room.GetRemoteParticipants()) + 1
+}
+
+// Close tears the session down exactly once: cancels all operations,
+// stops playback, unpublishes tracks, and disconnects from the room.
+func (s *RoomSession) Close() {
+	s.closeOnce.Do(func() {
+		log.Printf("closing room session for user %s", s.userID)
+		// Order matters: mark closed and cancel ctx before touching the
+		// room so late OnDataPacket callbacks bail out in forwardInbound.
+		s.closed.Store(true)
+		s.cancel()
+		s.stopPlayback()
+		if m := s.rtpMirror.Swap(nil); m != nil {
+			m.close()
+		}
+
+		s.mu.Lock()
+		if s.lingerTimer != nil {
+			s.lingerTimer.Stop()
+			s.lingerTimer = nil
+		}
+		for id, track := range s.tracks {
+			track.Close()
+			delete(s.tracks, id)
+		}
+		room := s.room
+		s.room = nil
+		s.mu.Unlock()
+
+		if room != nil {
+			room.Disconnect()
+		}
+		// audioFromLiveKit is deliberately left open (readers select on
+		// ctx.Done()); closing it here raced with in-flight sends.
+		s.emit(pb.BridgeEvent_ROOM_LEFT, nil)
+		log.Printf("closed room session for user %s", s.userID)
+	})
+}
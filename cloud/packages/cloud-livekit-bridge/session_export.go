@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Session export/import lets orchestration tooling move a user between
+// instances or recover them after a crash: ExportSession produces an
+// encrypted blob of everything needed to rebuild the session, and
+// ImportSession on another instance replays it through JoinRoom. The
+// blob contains the LiveKit token, hence the encryption; both sides
+// must share BRIDGE_SESSION_EXPORT_KEY.
+
+// sessionExport is the serialized session state (JSON inside the
+// encrypted blob). Version guards against replaying blobs across
+// incompatible bridge releases.
+type sessionExport struct {
+	Version    int   `json:"version"`
+	JoinedAtMs int64 `json:"joined_at_ms"`
+
+	Join *pb.JoinRoomRequest `json:"join"`
+
+	// Output shaping profile name ("" = default)
+	Profile string `json:"profile,omitempty"`
+
+	// UDP uplink registration, if any
+	UdpHash uint32 `json:"udp_hash,omitempty"`
+
+	// Published track formats, keyed by track ID, republished on import
+	// so post-import writers convert to the same format
+	Tracks map[int32]exportTrackFormat `json:"tracks,omitempty"`
+
+	// Pending queue entries per track, in play order. The entry playing
+	// at export time is not carried; it finishes (or dies) with the
+	// exporting instance.
+	Queues map[int32][]*pb.PlayAudioRequest `json:"queues,omitempty"`
+}
+
+// exportTrackFormat is a published track's format inside the blob
+// (trackFormat's fields are unexported).
+type exportTrackFormat struct {
+	Rate     int `json:"rate"`
+	Channels int `json:"channels"`
+}
+
+const sessionExportVersion = 1
+
+// sessionCipher derives an AEAD from a configured key string (SHA-256
+// into AES-256-GCM). The UDP packet encryption shares this derivation.
+func sessionCipher(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealSessionBlob(key string, export *sessionExport) ([]byte, error) {
+	plain, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := sessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openSessionBlob(key string, blob []byte) (*sessionExport, error) {
+	aead, err := sessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < aead.NonceSize() {
+		return nil, fmt.Errorf("blob too short")
+	}
+	plain, err := aead.Open(nil, blob[:aead.NonceSize()], blob[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	var export sessionExport
+	if err := json.Unmarshal(plain, &export); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	if export.Version != sessionExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+	return &export, nil
+}
+
+// ExportSession serializes and encrypts a user's session state.
+func (s *LiveKitBridgeService) ExportSession(ctx context.Context, req *pb.ExportSessionRequest) (*pb.ExportSessionResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if s.config.SessionExportKey == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "BRIDGE_SESSION_EXPORT_KEY not configured")
+	}
+	session := s.getSession(req.UserId)
+	if session == nil {
+		return &pb.ExportSessionResponse{Success: false, Error: "no session"}, nil
+	}
+	if err := s.checkTenant(ctx, session); err != nil {
+		return nil, err
+	}
+	if session.joinReq == nil {
+		return &pb.ExportSessionResponse{Success: false, Error: "session has no join parameters"}, nil
+	}
+
+	export := &sessionExport{
+		Version:    sessionExportVersion,
+		JoinedAtMs: session.joinedAt.UnixMilli(),
+		Join:       session.joinReq,
+	}
+	if p := session.outputProfile.Load(); p != nil {
+		export.Profile = p.name
+	}
+	if s.udp != nil {
+		if hash, ok := s.udp.hashFor(req.UserId); ok {
+			export.UdpHash = hash
+		}
+	}
+	for trackID, f := range session.exportTrackFormats() {
+		if export.Tracks == nil {
+			export.Tracks = make(map[int32]exportTrackFormat)
+		}
+		export.Tracks[trackID] = exportTrackFormat{Rate: f.rate, Channels: f.channels}
+	}
+	export.Queues = session.exportQueues()
+
+	blob, err := sealSessionBlob(s.config.SessionExportKey, export)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "seal export: %v", err)
+	}
+	log.Printf("exported session for user %s (%d bytes)", req.UserId, len(blob))
+	return &pb.ExportSessionResponse{Success: true, Blob: blob}, nil
+}
+
+// ImportSession rebuilds a session from an exported blob by replaying
+// it through JoinRoom. The embedded LiveKit token may have expired
+// since export; that surfaces as a normal join failure.
+func (s *LiveKitBridgeService) ImportSession(ctx context.Context, req *pb.ImportSessionRequest) (*pb.ImportSessionResponse, error) {
+	if len(req.Blob) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "blob required")
+	}
+	if s.config.SessionExportKey == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "BRIDGE_SESSION_EXPORT_KEY not configured")
+	}
+	export, err := openSessionBlob(s.config.SessionExportKey, req.Blob)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "open export: %v", err)
+	}
+	if export.Join == nil || export.Join.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "export has no join parameters")
+	}
+	userID := export.Join.UserId
+
+	joinResp, err := s.JoinRoom(ctx, export.Join)
+	if err != nil {
+		return nil, err
+	}
+	if !joinResp.Success {
+		return &pb.ImportSessionResponse{Success: false, Error: joinResp.Error, UserId: userID}, nil
+	}
+
+	if session := s.getSession(userID); session != nil {
+		if export.Profile != "" {
+			if profile, err := profileByName(export.Profile); err == nil {
+				session.outputProfile.Store(profile)
+			}
+		}
+		for trackID, f := range export.Tracks {
+			if _, _, err := session.getOrCreateTrack(trackID, trackFormat{rate: f.Rate, channels: f.Channels}); err != nil {
+				log.Printf("ImportSession: republish track %d for user %s: %v", trackID, userID, err)
+			}
+		}
+		// Re-enqueue the exported queue entries; the worker starts
+		// exactly as EnqueueAudio would have started it.
+		for trackID, entries := range export.Queues {
+			var start bool
+			for _, entry := range entries {
+				_, st := session.enqueue(entry)
+				start = start || st
+			}
+			if start {
+				go s.runQueue(session, trackID)
+			}
+		}
+	}
+	if export.UdpHash != 0 && s.udp != nil {
+		if _, err := s.RegisterUdpUser(ctx, &pb.RegisterUdpUserRequest{
+			UserId:     userID,
+			UserIdHash: export.UdpHash,
+		}); err != nil {
+			log.Printf("ImportSession: re-register udp for user %s: %v", userID, err)
+		}
+	}
+	log.Printf("imported session for user %s", userID)
+	return &pb.ImportSessionResponse{Success: true, UserId: userID}, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Session metrics: a periodic SESSION_METRICS event per session on the
+// SubscribeEvents stream, so the cloud's health dashboard sees
+// bridge-side rates (inbound frames, playback output, drops, buffer
+// depth) without polling GetStatus per user. Rates are computed from
+// counter deltas between samples; the first observation of a session
+// only seeds the baseline.
+
+// sessionCounterSnapshot is one session's counters at a sample time.
+type sessionCounterSnapshot struct {
+	at              time.Time
+	framesForwarded int64
+	framesDropped   int64
+	framesConcealed int64
+	samplesPlayed   int64
+}
+
+func snapshotCounters(session *RoomSession, at time.Time) sessionCounterSnapshot {
+	return sessionCounterSnapshot{
+		at:              at,
+		framesForwarded: atomic.LoadInt64(&session.framesForwarded),
+		framesDropped:   atomic.LoadInt64(&session.framesDropped),
+		framesConcealed: atomic.LoadInt64(&session.framesConcealed),
+		samplesPlayed:   atomic.LoadInt64(&session.samplesPlayed),
+	}
+}
+
+// sessionMetricsLoop samples every session's counters on the interval
+// and publishes the deltas as SESSION_METRICS events. Baselines are
+// keyed by session pointer, so a user rejoining starts a fresh baseline
+// instead of inheriting the dead session's counters.
+func (s *LiveKitBridgeService) sessionMetricsLoop(interval time.Duration) {
+	prev := make(map[*RoomSession]sessionCounterSnapshot)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		sessions := make([]*RoomSession, 0, len(s.sessions))
+		for _, session := range s.sessions {
+			sessions = append(sessions, session)
+		}
+		s.mu.Unlock()
+
+		now := time.Now()
+		live := make(map[*RoomSession]bool, len(sessions))
+		for _, session := range sessions {
+			live[session] = true
+			cur := snapshotCounters(session, now)
+			last, seeded := prev[session]
+			prev[session] = cur
+			if !seeded {
+				continue
+			}
+			secs := cur.at.Sub(last.at).Seconds()
+			if secs <= 0 {
+				continue
+			}
+			var bufferMs int64
+			for _, ms := range session.trackBufferMs() {
+				if ms > bufferMs {
+					bufferMs = ms
+				}
+			}
+			s.events.publish(&pb.BridgeEvent{
+				Type:        pb.BridgeEvent_SESSION_METRICS,
+				UserId:      session.userID,
+				TimestampMs: now.UnixMilli(),
+				Attributes: map[string]string{
+					"frames_in_per_sec":   fmt.Sprintf("%.1f", float64(cur.framesForwarded-last.framesForwarded)/secs),
+					"samples_out_per_sec": fmt.Sprintf("%.0f", float64(cur.samplesPlayed-last.samplesPlayed)/secs),
+					"frames_dropped":      strconv.FormatInt(cur.framesDropped-last.framesDropped, 10),
+					"frames_concealed":    strconv.FormatInt(cur.framesConcealed-last.framesConcealed, 10),
+					"buffer_ms":           strconv.FormatInt(bufferMs, 10),
+					"audio_level":         strconv.FormatInt(session.audioLevel.Load(), 10),
+				},
+			})
+		}
+		// Drop baselines for sessions that have gone away.
+		for session := range prev {
+			if !live[session] {
+				delete(prev, session)
+			}
+		}
+	}
+}
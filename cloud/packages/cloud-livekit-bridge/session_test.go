@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Regression test for the "send on closed channel" panic: Close() used to
+// close audioFromLiveKit while OnDataPacket callbacks were still sending,
+// crashing the whole bridge. Late frames must now be dropped safely.
+func TestForwardInboundDuringClose(t *testing.T) {
+	session := NewRoomSession("test-user", 4, nil)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 1000; j++ {
+				session.forwardInbound(&inboundFrame{pcm: []byte{0, 0}}, 0)
+			}
+		}()
+	}
+	close(start)
+	session.Close()
+	wg.Wait()
+
+	// Frames arriving after Close must be dropped, not delivered.
+	before := atomic.LoadInt64(&session.framesForwarded)
+	session.forwardInbound(&inboundFrame{pcm: []byte{0, 0}}, 0)
+	if got := atomic.LoadInt64(&session.framesForwarded); got != before {
+		t.Errorf("frame forwarded after Close: forwarded=%d want %d", got, before)
+	}
+	if atomic.LoadInt64(&session.framesDropped) == 0 {
+		t.Errorf("expected late frames to be counted as dropped")
+	}
+}
+
+// Close must be idempotent (it is called from multiple error paths).
+func TestCloseIdempotent(t *testing.T) {
+	session := NewRoomSession("test-user", 4, nil)
+	session.Close()
+	session.Close()
+}
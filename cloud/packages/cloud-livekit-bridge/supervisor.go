@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Panic isolation. A panic in one user's decode loop or in the UDP read
+// loop used to take down the whole process, killing every user's audio.
+// Three layers contain the blast radius instead:
+//
+//   - runProtected turns a panic in a playback into a normal playback
+//     failure, and the owning session is quarantined against new
+//     playbacks until the user rejoins (the input that tripped the
+//     panic tends to come right back)
+//   - superviseLoop restarts long-running component goroutines after a
+//     panic, with a restart cap so a deterministic crash can't spin
+//   - last-resort gRPC interceptors convert handler panics into
+//     INTERNAL errors for that one call
+const (
+	supervisorMaxRestarts  = 5
+	supervisorRestartDelay = time.Second
+)
+
+// panicError is what runProtected returns for a recovered panic, so
+// callers can tell a crash from an ordinary failure.
+type panicError struct {
+	component string
+	value     any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.component, e.value)
+}
+
+// logPanic logs a recovered panic with its stack.
+func logPanic(component string, r any) {
+	log.Printf("panic in %s: %v\n%s", component, r, debug.Stack())
+}
+
+// runProtected runs fn, converting a panic into a *panicError.
+func runProtected(component string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(component, r)
+			err = &panicError{component: component, value: r}
+		}
+	}()
+	return fn()
+}
+
+// superviseLoop runs loop in a goroutine and restarts it after a panic,
+// up to supervisorMaxRestarts times. A clean return is a deliberate
+// exit and is not restarted.
+func superviseLoop(name string, loop func()) {
+	go func() {
+		for restarts := 0; ; restarts++ {
+			panicked := func() (panicked bool) {
+				defer func() {
+					if r := recover(); r != nil {
+						logPanic(name, r)
+						panicked = true
+					}
+				}()
+				loop()
+				return false
+			}()
+			if !panicked {
+				return
+			}
+			if restarts >= supervisorMaxRestarts {
+				log.Printf("%s: giving up after %d panics", name, restarts+1)
+				return
+			}
+			log.Printf("%s: restarting after panic (restart #%d)", name, restarts+1)
+			time.Sleep(supervisorRestartDelay)
+		}
+	}()
+}
+
+// panicUnaryInterceptor is the last-resort catch for handler panics.
+func (s *LiveKitBridgeService) panicUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(info.FullMethod, r)
+			err = status.Errorf(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// panicStreamInterceptor is panicUnaryInterceptor for streaming RPCs.
+func (s *LiveKitBridgeService) panicStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic(info.FullMethod, r)
+			err = status.Errorf(codes.Internal, "internal error")
+		}
+	}()
+	return handler(srv, ss)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Multi-tenancy: one bridge deployment serving several MentraOS
+// environments or partner organizations. The tenant is derived from an
+// API key in request metadata (BRIDGE_TENANT_KEYS maps keys to tenant
+// names), and sessions, listings, quotas, and usage accounting are all
+// scoped to the authenticated tenant — one tenant's key cannot touch
+// another's sessions. With no keys configured the bridge runs exactly
+// as before: no key check, everything in the "default" tenant.
+const (
+	// Request metadata key carrying the tenant API key
+	tenantMetadataKey = "x-bridge-tenant-key"
+
+	// Tenant name used when multi-tenancy is not configured
+	defaultTenant = "default"
+)
+
+type tenantCtxKey struct{}
+
+// parseTenantKeys parses "key=tenant;key2=tenant2" from the env.
+// Malformed entries are logged and skipped (empty → nil, single-tenant).
+func parseTenantKeys(spec string) map[string]string {
+	if spec == "" {
+		return nil
+	}
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, tenant, ok := strings.Cut(entry, "=")
+		if !ok || key == "" || tenant == "" {
+			log.Printf("config: bad tenant key entry %q (want key=tenant), skipping", entry)
+			continue
+		}
+		keys[key] = tenant
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys
+}
+
+// resolveTenant authenticates the request's tenant key. Keys are only
+// required when BRIDGE_TENANT_KEYS is configured.
+func (s *LiveKitBridgeService) resolveTenant(ctx context.Context) (string, error) {
+	if len(s.config.TenantKeys) == 0 {
+		return defaultTenant, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(tenantMetadataKey)
+	if len(keys) == 0 {
+		return "", status.Errorf(codes.Unauthenticated, "tenant key required (%s metadata)", tenantMetadataKey)
+	}
+	tenant, ok := s.config.TenantKeys[keys[0]]
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "unknown tenant key")
+	}
+	return tenant, nil
+}
+
+// tenantFromContext returns the tenant the interceptor resolved.
+func tenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantCtxKey{}).(string); ok {
+		return tenant
+	}
+	return defaultTenant
+}
+
+// checkTenant rejects access to a session owned by another tenant. The
+// error deliberately does not say which tenant owns the session.
+func (s *LiveKitBridgeService) checkTenant(ctx context.Context, session *RoomSession) error {
+	if session.tenant == tenantFromContext(ctx) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "user %s belongs to a different tenant", session.userID)
+}
+
+// tenantSessionCount counts active sessions owned by one tenant.
+func (s *LiveKitBridgeService) tenantSessionCount(tenant string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, session := range s.sessions {
+		if session.tenant == tenant {
+			count++
+		}
+	}
+	return count
+}
+
+// tenantUsage accumulates per-tenant playback milliseconds for usage
+// accounting, alongside the per-user policy engine's bookkeeping.
+type tenantUsage struct {
+	mu         sync.Mutex
+	playbackMs map[string]int64
+}
+
+func newTenantUsage() *tenantUsage {
+	return &tenantUsage{playbackMs: make(map[string]int64)}
+}
+
+func (t *tenantUsage) recordPlayback(tenant string, ms int64) {
+	if ms <= 0 {
+		return
+	}
+	t.mu.Lock()
+	t.playbackMs[tenant] += ms
+	t.mu.Unlock()
+}
+
+func (t *tenantUsage) playbackMsFor(tenant string) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.playbackMs[tenant]
+}
+
+// tenantUnaryInterceptor authenticates the tenant and stores it in the
+// handler context.
+func (s *LiveKitBridgeService) tenantUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	tenant, err := s.resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, tenantCtxKey{}, tenant), req)
+}
+
+// tenantServerStream overrides the stream context with the tenant.
+type tenantServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ts *tenantServerStream) Context() context.Context { return ts.ctx }
+
+// tenantStreamInterceptor is tenantUnaryInterceptor for streaming RPCs.
+func (s *LiveKitBridgeService) tenantStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	tenant, err := s.resolveTenant(ss.Context())
+	if err != nil {
+		return err
+	}
+	ctx := context.WithValue(ss.Context(), tenantCtxKey{}, tenant)
+	return handler(srv, &tenantServerStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// transcriptHub fans transcripts out to SubscribeTranscripts streams.
+// The ASR-forwarding consumer publishes interim and final results back
+// into the bridge so lightweight consumers (captions overlay) can read
+// them here without standing up the full cloud pipeline. Like the event
+// hub, slow subscribers miss transcripts rather than blocking the
+// publisher; a captions overlay wants the latest text anyway.
+type transcriptHub struct {
+	mu     sync.Mutex
+	nextID int64
+	subs   map[int64]*transcriptSub
+}
+
+type transcriptSub struct {
+	userID    string // empty = all users
+	finalOnly bool
+	ch        chan *pb.Transcript
+}
+
+func newTranscriptHub() *transcriptHub {
+	return &transcriptHub{subs: make(map[int64]*transcriptSub)}
+}
+
+func (h *transcriptHub) subscribe(userID string, finalOnly bool) (int64, <-chan *pb.Transcript) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	id := h.nextID
+	sub := &transcriptSub{userID: userID, finalOnly: finalOnly, ch: make(chan *pb.Transcript, 32)}
+	h.subs[id] = sub
+	return id, sub.ch
+}
+
+func (h *transcriptHub) unsubscribe(id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, id)
+}
+
+func (h *transcriptHub) publish(t *pb.Transcript) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subs {
+		if sub.userID != "" && sub.userID != t.UserId {
+			continue
+		}
+		if sub.finalOnly && !t.Final {
+			continue
+		}
+		select {
+		case sub.ch <- t:
+		default:
+			// Subscriber not draining; drop rather than block ASR.
+		}
+	}
+}
+
+// PublishTranscript ingests one ASR result for fan-out. Called by the
+// ASR-forwarding consumer for every interim and final segment.
+func (s *LiveKitBridgeService) PublishTranscript(ctx context.Context, req *pb.PublishTranscriptRequest) (*pb.PublishTranscriptResponse, error) {
+	t := req.Transcript
+	if t == nil || t.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "transcript with user_id required")
+	}
+	if t.TimestampMs == 0 {
+		t.TimestampMs = time.Now().UnixMilli()
+	}
+	s.transcripts.publish(t)
+	return &pb.PublishTranscriptResponse{Success: true}, nil
+}
+
+// SubscribeTranscripts streams transcripts for a user (or all users)
+// until the client disconnects.
+func (s *LiveKitBridgeService) SubscribeTranscripts(req *pb.SubscribeTranscriptsRequest, stream pb.LiveKitBridge_SubscribeTranscriptsServer) error {
+	id, ch := s.transcripts.subscribe(req.UserId, req.FinalOnly)
+	defer s.transcripts.unsubscribe(id)
+	log.Printf("transcript subscriber %d attached (user=%q, final_only=%v)", id, req.UserId, req.FinalOnly)
+
+	for {
+		select {
+		case t := <-ch:
+			if err := stream.Send(t); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
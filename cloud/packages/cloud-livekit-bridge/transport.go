@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Inbound audio transports for a session.
+const (
+	transportLiveKit = "livekit"
+	transportUDP     = "udp"
+)
+
+// transportStaleAfter is how long a transport may go silent before the
+// selector stops considering it healthy. UDP clients ping every few
+// seconds even when silent, so a stale UDP path really is gone.
+const transportStaleAfter = 2 * time.Second
+
+// transportSelector picks which inbound path feeds the gRPC stream when a
+// phone sends audio over both LiveKit DataChannel and UDP (normal during
+// switchover). UDP is preferred while fresh (lower latency); LiveKit takes
+// over when the UDP path goes stale. Frames arriving on the inactive
+// transport are dropped, which is what de-duplicates audio flowing on
+// both paths at once.
+type transportSelector struct {
+	mu       sync.Mutex
+	userID   string
+	active   string
+	lastSeen map[string]time.Time
+	switches int64
+
+	// Called on every switch (timeline recording); may be nil.
+	onSwitch func(from, to string)
+}
+
+func newTransportSelector(userID string) *transportSelector {
+	return &transportSelector{
+		userID:   userID,
+		active:   transportLiveKit,
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// admit records an arrival on transport and reports whether the frame
+// should be forwarded.
+func (t *transportSelector) admit(transport string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSeen[transport] = now
+
+	preferred := transportLiveKit
+	if now.Sub(t.lastSeen[transportUDP]) < transportStaleAfter {
+		preferred = transportUDP
+	}
+	if preferred != t.active {
+		t.switches++
+		log.Printf("inbound transport for user %s: %s -> %s", t.userID, t.active, preferred)
+		if t.onSwitch != nil {
+			t.onSwitch(t.active, preferred)
+		}
+		t.active = preferred
+	}
+	return transport == t.active
+}
+
+// activeTransport reports the currently selected transport for GetStatus.
+func (t *transportSelector) activeTransport() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// UDP packet layouts.
+//
+// v1 (shipped mobile builds, no version field):
+//
+//	bytes 0-3: userIdHash (FNV-1a 32-bit, big-endian)
+//	bytes 4-5: sequence number (big-endian)
+//	bytes 6+:  PCM16 LE mono 16kHz, or the literal "PING"
+//
+// v2 (versioned, distinguished by a leading magic that is vanishingly
+// unlikely to collide with a userIdHash):
+//
+//	bytes 0-3:   magic "MENT"
+//	byte  4:     protocol version (currently 2)
+//	byte  5:     payload type (0=pcm16, 1=opus reserved, 2=ping,
+//	             3=g722, 4=lc3 reserved)
+//	bytes 6-9:   userIdHash (FNV-1a 32-bit, big-endian)
+//	bytes 10-11: sequence number (big-endian)
+//	bytes 12+:   payload
+//
+// With BRIDGE_UDP_ENCRYPTION_KEY set, every datagram is instead a
+// 12-byte nonce followed by the AES-256-GCM ciphertext of a v1/v2
+// packet, sealed with the key advertised in RegisterUdpUserResponse
+// (the SHA-256 of the configured passphrase, the same derivation as
+// the session export blob). Plaintext or wrongly-keyed datagrams fail
+// authentication and are dropped.
+const (
+	udpHeaderSize    = 6
+	udpV2Magic       = 0x4d454e54 // "MENT"
+	udpV2HeaderSize  = 12
+	udpMaxPacketSize = 4096
+
+	udpProtocolVersion = 2 // highest version this build understands
+
+	udpPayloadPCM16 = 0
+	udpPayloadOpus  = 1 // reserved, not yet decoded
+	udpPayloadPing  = 2
+	udpPayloadG722  = 3 // decoded bridge-side, see g722.go
+	udpPayloadLC3   = 4 // reserved: no pure-Go decoder exists (see g722.go)
+)
+
+// UdpAudioListener receives uplink audio from mobile clients over UDP and
+// routes it into the owning user's RoomSession, bypassing LiveKit for
+// latency. Registration (userIdHash → userId) comes from the cloud via the
+// RegisterUdpUser RPC; pings are surfaced on SubscribeUdpPings so the cloud
+// can ack them over the glasses WebSocket.
+type UdpAudioListener struct {
+	service *LiveKitBridgeService
+	port    int
+
+	// Packet encryption, derived once in Start and immutable after
+	// (nil/empty when BRIDGE_UDP_ENCRYPTION_KEY is unset).
+	aead   cipher.AEAD
+	encKey []byte
+
+	mu       sync.Mutex
+	conn     *net.UDPConn
+	users    map[uint32]string // userIdHash → userId
+	lastSeen map[uint32]int64  // last packet arrival (ms since epoch)
+	pathLost map[uint32]bool   // users past the ping timeout
+	lastSeq  map[uint32]int32  // last accepted sequence (-1 = none yet)
+	g722     map[uint32]*g722Decoder
+	stop     chan struct{}
+
+	pingMu     sync.Mutex
+	pingNextID int64
+	pingSubs   map[int64]*udpPingSub
+
+	// Active pcap capture (admin-triggered, at most one), see udp_capture.go
+	captureMu sync.Mutex
+	capture   *udpCapture
+
+	listening       atomic.Bool
+	stopping        atomic.Bool
+	restarts        atomic.Int64
+	evictions       atomic.Int64
+	lastError       atomic.Value // string
+	packetsReceived atomic.Int64
+	packetsDropped  atomic.Int64
+	packetsDeduped  atomic.Int64
+	pingsReceived   atomic.Int64
+	bytesReceived   atomic.Int64
+}
+
+type udpPingSub struct {
+	userID string // empty = all users
+	ch     chan *pb.UdpPingEvent
+}
+
+func NewUdpAudioListener(service *LiveKitBridgeService, port int) *UdpAudioListener {
+	return &UdpAudioListener{
+		service:  service,
+		port:     port,
+		users:    make(map[uint32]string),
+		lastSeen: make(map[uint32]int64),
+		pathLost: make(map[uint32]bool),
+		lastSeq:  make(map[uint32]int32),
+		g722:     make(map[uint32]*g722Decoder),
+		pingSubs: make(map[int64]*udpPingSub),
+	}
+}
+
+// Start binds the socket and runs the read loop until Stop.
+func (u *UdpAudioListener) Start() error {
+	u.stopping.Store(false)
+	if key := u.service.config.UDPEncryptionKey; key != "" && u.aead == nil {
+		aead, err := sessionCipher(key)
+		if err != nil {
+			return fmt.Errorf("udp encryption key: %w", err)
+		}
+		sum := sha256.Sum256([]byte(key))
+		u.aead = aead
+		u.encKey = sum[:]
+		log.Printf("udp packet encryption enabled")
+	}
+	if path := u.service.config.UDPStateFile; path != "" {
+		u.loadRegistrations(path)
+	}
+	addr := &net.UDPAddr{Port: u.port}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("bind udp :%d: %w", u.port, err)
+	}
+	u.mu.Lock()
+	u.conn = conn
+	u.stop = make(chan struct{})
+	u.mu.Unlock()
+	u.listening.Store(true)
+	log.Printf("udp audio listener on :%d", u.port)
+
+	superviseLoop("udp read loop", func() { u.readLoop(conn) })
+	if u.service.config.UDPPingTimeout > 0 {
+		superviseLoop("udp ping monitor", func() { u.monitorPings(u.service.config.UDPPingTimeout) })
+	}
+	return nil
+}
+
+// monitorPings declares a user's UDP path lost when no packet (ping or
+// audio) has arrived within timeout, so the cloud can tell the phone to
+// fall back to LiveKit audio promptly.
+func (u *UdpAudioListener) monitorPings(timeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+			now := time.Now().UnixMilli()
+			var lost []string
+			u.mu.Lock()
+			for hash, userID := range u.users {
+				last := u.lastSeen[hash]
+				if last == 0 || u.pathLost[hash] {
+					continue
+				}
+				if now-last > timeout.Milliseconds() {
+					u.pathLost[hash] = true
+					lost = append(lost, userID)
+				}
+			}
+			u.mu.Unlock()
+			for _, userID := range lost {
+				log.Printf("udp path lost for user %s (no packet for %s)", userID, timeout)
+				u.service.events.publish(&pb.BridgeEvent{
+					Type:        pb.BridgeEvent_UDP_PATH_LOST,
+					UserId:      userID,
+					TimestampMs: now,
+				})
+			}
+		}
+	}
+}
+
+func (u *UdpAudioListener) readLoop(conn *net.UDPConn) {
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		n, remote, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// Quiet exit when this socket was deliberately replaced
+			// (Stop or rebind); otherwise supervise a rebind so a fatal
+			// socket error (EMFILE, interface change) doesn't kill
+			// uplink audio silently.
+			u.mu.Lock()
+			current := u.conn == conn
+			u.mu.Unlock()
+			if !current || u.stopping.Load() {
+				return
+			}
+			u.listening.Store(false)
+			u.lastError.Store(err.Error())
+			log.Printf("udp read loop failed: %v, scheduling rebind", err)
+			go u.superviseRebind()
+			return
+		}
+		u.handlePacket(buf[:n], remote)
+	}
+}
+
+// rebind replaces the socket and starts a fresh read loop. The old read
+// loop (if any) notices its socket is no longer current and exits quietly.
+func (u *UdpAudioListener) rebind() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.conn != nil {
+		u.conn.Close()
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: u.port})
+	if err != nil {
+		u.lastError.Store(err.Error())
+		return fmt.Errorf("bind udp :%d: %w", u.port, err)
+	}
+	u.conn = conn
+	u.restarts.Add(1)
+	u.listening.Store(true)
+	superviseLoop("udp read loop", func() { u.readLoop(conn) })
+	return nil
+}
+
+// superviseRebind retries rebinding with backoff until it succeeds or the
+// listener is stopped.
+func (u *UdpAudioListener) superviseRebind() {
+	backoff := time.Second
+	for {
+		if u.stopping.Load() {
+			return
+		}
+		if err := u.rebind(); err == nil {
+			log.Printf("udp listener rebound on :%d (restart #%d)", u.port, u.restarts.Load())
+			return
+		} else {
+			log.Printf("udp rebind failed: %v (retrying in %s)", err, backoff)
+		}
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (u *UdpAudioListener) handlePacket(packet []byte, remote *net.UDPAddr) {
+	if u.aead != nil {
+		ns := u.aead.NonceSize()
+		if len(packet) < ns+u.aead.Overhead() {
+			u.packetsDropped.Add(1)
+			return
+		}
+		plain, err := u.aead.Open(nil, packet[:ns], packet[ns:], nil)
+		if err != nil {
+			// Plaintext or wrongly-keyed packets fail authentication.
+			u.packetsDropped.Add(1)
+			return
+		}
+		packet = plain
+	}
+	if len(packet) < udpHeaderSize {
+		u.packetsDropped.Add(1)
+		return
+	}
+	u.packetsReceived.Add(1)
+	u.bytesReceived.Add(int64(len(packet)))
+
+	// Parse the header: v2 starts with the magic, anything else is the
+	// original unversioned layout from shipped mobile builds.
+	var (
+		hash        uint32
+		seq         uint16
+		payload     []byte
+		payloadType = udpPayloadPCM16
+	)
+	if len(packet) >= udpV2HeaderSize &&
+		uint32(packet[0])<<24|uint32(packet[1])<<16|uint32(packet[2])<<8|uint32(packet[3]) == udpV2Magic {
+		if packet[4] > udpProtocolVersion {
+			u.packetsDropped.Add(1)
+			return
+		}
+		payloadType = int(packet[5])
+		hash = uint32(packet[6])<<24 | uint32(packet[7])<<16 | uint32(packet[8])<<8 | uint32(packet[9])
+		seq = uint16(packet[10])<<8 | uint16(packet[11])
+		payload = packet[udpV2HeaderSize:]
+	} else {
+		hash = uint32(packet[0])<<24 | uint32(packet[1])<<16 | uint32(packet[2])<<8 | uint32(packet[3])
+		seq = uint16(packet[4])<<8 | uint16(packet[5])
+		payload = packet[udpHeaderSize:]
+		if len(payload) == 4 && string(payload) == "PING" {
+			payloadType = udpPayloadPing
+		}
+	}
+	u.maybeCapture(hash, packet)
+
+	u.mu.Lock()
+	userID, registered := u.users[hash]
+	var restored bool
+	if registered {
+		u.lastSeen[hash] = time.Now().UnixMilli()
+		if u.pathLost[hash] {
+			delete(u.pathLost, hash)
+			restored = true
+		}
+	}
+	u.mu.Unlock()
+	if !registered {
+		u.packetsDropped.Add(1)
+		return
+	}
+	if restored {
+		log.Printf("udp path restored for user %s", userID)
+		u.service.events.publish(&pb.BridgeEvent{
+			Type:        pb.BridgeEvent_UDP_PATH_RESTORED,
+			UserId:      userID,
+			TimestampMs: time.Now().UnixMilli(),
+		})
+	}
+
+	if payloadType == udpPayloadPing {
+		u.pingsReceived.Add(1)
+		u.publishPing(&pb.UdpPingEvent{
+			UserIdHash:  hash,
+			UserId:      userID,
+			RemoteAddr:  remote.String(),
+			TimestampMs: time.Now().UnixMilli(),
+		})
+		return
+	}
+	if payloadType != udpPayloadPCM16 && payloadType != udpPayloadG722 {
+		// Opus and LC3 are negotiated payload types but not decoded:
+		// the available decoders are C libraries and this build is
+		// pure Go (see g722.go).
+		u.packetsDropped.Add(1)
+		return
+	}
+
+	// De-duplicate on the 16-bit packet sequence: during transport
+	// switches the phone may resend frames it also pushed over the
+	// LiveKit DataChannel, and ASR stutters on doubled audio. Replays
+	// and reordered-older packets are dropped (wraparound-safe).
+	u.mu.Lock()
+	last, seen := u.lastSeq[hash]
+	if seen && int16(seq-uint16(last)) <= 0 {
+		u.mu.Unlock()
+		u.packetsDeduped.Add(1)
+		return
+	}
+	u.lastSeq[hash] = int32(seq)
+	u.mu.Unlock()
+
+	session := u.service.getSession(userID)
+	if session == nil {
+		u.packetsDropped.Add(1)
+		return
+	}
+	var pcm []byte
+	if payloadType == udpPayloadG722 {
+		// Decode to 16kHz PCM. The decoder is per-sender and survives
+		// sequence gaps: ADPCM reconverges on its own (see g722.go).
+		u.mu.Lock()
+		dec := u.g722[hash]
+		if dec == nil {
+			dec = newG722Decoder()
+			u.g722[hash] = dec
+		}
+		u.mu.Unlock()
+		pcm = int16ToBytes(dec.decode(payload))
+	} else {
+		// Copy: the read loop reuses its buffer.
+		pcm = make([]byte, len(payload))
+		copy(pcm, payload)
+	}
+	session.forwardInbound(&inboundFrame{
+		pcm:            pcm,
+		senderIdentity: userID,
+		trackName:      "udp",
+	}, u.service.config.LogEveryFrames)
+}
+
+func (u *UdpAudioListener) publishPing(ev *pb.UdpPingEvent) {
+	u.pingMu.Lock()
+	defer u.pingMu.Unlock()
+	for _, sub := range u.pingSubs {
+		if sub.userID != "" && sub.userID != ev.UserId {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// evictIdleUser drops the least-recently-seen registration that has no
+// active RoomSession and no recent packets, making room under the cap.
+// Returns false when every entry is either active or recently seen.
+func (u *UdpAudioListener) evictIdleUser() bool {
+	staleAfter := u.service.config.UDPPingTimeout
+	if staleAfter <= 0 {
+		staleAfter = 30 * time.Second
+	}
+	cutoff := time.Now().Add(-staleAfter).UnixMilli()
+
+	type candidate struct {
+		hash     uint32
+		userID   string
+		lastSeen int64
+	}
+	u.mu.Lock()
+	candidates := make([]candidate, 0, len(u.users))
+	for hash, userID := range u.users {
+		candidates = append(candidates, candidate{hash, userID, u.lastSeen[hash]})
+	}
+	u.mu.Unlock()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].lastSeen < candidates[j].lastSeen })
+
+	for _, c := range candidates {
+		if c.lastSeen > cutoff {
+			// Everything further is recently seen; nothing to evict.
+			return false
+		}
+		// Session check happens outside u.mu (getSession takes the
+		// service lock).
+		if u.service.getSession(c.userID) != nil {
+			continue
+		}
+		u.mu.Lock()
+		if u.users[c.hash] != c.userID || u.lastSeen[c.hash] != c.lastSeen {
+			u.mu.Unlock()
+			continue
+		}
+		delete(u.users, c.hash)
+		delete(u.lastSeen, c.hash)
+		delete(u.pathLost, c.hash)
+		delete(u.lastSeq, c.hash)
+		delete(u.g722, c.hash)
+		u.mu.Unlock()
+		u.persist()
+		u.evictions.Add(1)
+		log.Printf("evicted idle udp user %s (hash=%d) to stay under cap", c.userID, c.hash)
+		return true
+	}
+	return false
+}
+
+// pathState reports UDP uplink liveness for GetStatus.
+func (u *UdpAudioListener) pathState(userID string) (alive bool, lastSeen int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for hash, id := range u.users {
+		if id == userID {
+			last := u.lastSeen[hash]
+			return last > 0 && !u.pathLost[hash], last
+		}
+	}
+	return false, 0
+}
+
+// Stop closes the socket and clears registrations.
+func (u *UdpAudioListener) Stop() {
+	u.stopping.Store(true)
+	u.mu.Lock()
+	conn := u.conn
+	u.conn = nil
+	u.users = make(map[uint32]string)
+	u.lastSeen = make(map[uint32]int64)
+	u.pathLost = make(map[uint32]bool)
+	u.lastSeq = make(map[uint32]int32)
+	u.g722 = make(map[uint32]*g722Decoder)
+	if u.stop != nil {
+		close(u.stop)
+		u.stop = nil
+	}
+	u.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	u.listening.Store(false)
+}
+
+// --- gRPC surface ---
+
+// RegisterUdpUser maps a userIdHash to a userId for packet routing.
+func (s *LiveKitBridgeService) RegisterUdpUser(ctx context.Context, req *pb.RegisterUdpUserRequest) (*pb.RegisterUdpUserResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id required")
+	}
+	if s.udp == nil {
+		return &pb.RegisterUdpUserResponse{Success: false, Error: "udp listener disabled"}, nil
+	}
+	s.udp.mu.Lock()
+	_, exists := s.udp.users[req.UserIdHash]
+	full := !exists && s.config.UDPMaxUsers > 0 && len(s.udp.users) >= s.config.UDPMaxUsers
+	s.udp.mu.Unlock()
+	if full && !s.udp.evictIdleUser() {
+		log.Printf("udp registration table full (%d), rejecting user %s", s.config.UDPMaxUsers, req.UserId)
+		return &pb.RegisterUdpUserResponse{Success: false, Error: "registration table full"}, nil
+	}
+	s.udp.mu.Lock()
+	s.udp.users[req.UserIdHash] = req.UserId
+	// Fresh registration starts a fresh sequence space and codec state.
+	delete(s.udp.lastSeq, req.UserIdHash)
+	delete(s.udp.g722, req.UserIdHash)
+	s.udp.mu.Unlock()
+	s.udp.persist()
+	log.Printf("registered udp user %s (hash=%d)", req.UserId, req.UserIdHash)
+	// Hand back connectivity parameters so clients stop hardcoding them.
+	return &pb.RegisterUdpUserResponse{
+		Success:            true,
+		Endpoints:          s.config.UDPPublicAddrs,
+		PayloadTypes:       []string{"pcm16", "g722"},
+		EncryptionKey:      s.udp.encKey,
+		PingIntervalMs:     int32(s.config.UDPPingInterval / time.Millisecond),
+		MaxProtocolVersion: udpProtocolVersion,
+	}, nil
+}
+
+// hashFor returns the registered userIdHash for userID, if any.
+func (u *UdpAudioListener) hashFor(userID string) (uint32, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for hash, id := range u.users {
+		if id == userID {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+// UnregisterUdpUser removes the userIdHash mapping.
+func (s *LiveKitBridgeService) UnregisterUdpUser(ctx context.Context, req *pb.UnregisterUdpUserRequest) (*pb.UnregisterUdpUserResponse, error) {
+	if s.udp == nil {
+		return &pb.UnregisterUdpUserResponse{Success: false, Error: "udp listener disabled"}, nil
+	}
+	s.udp.mu.Lock()
+	delete(s.udp.users, req.UserIdHash)
+	delete(s.udp.lastSeen, req.UserIdHash)
+	delete(s.udp.pathLost, req.UserIdHash)
+	delete(s.udp.lastSeq, req.UserIdHash)
+	delete(s.udp.g722, req.UserIdHash)
+	s.udp.mu.Unlock()
+	s.udp.persist()
+	return &pb.UnregisterUdpUserResponse{Success: true}, nil
+}
+
+// RegisterUdpUsersBatch registers many users in one RPC (cloud reconnect).
+func (s *LiveKitBridgeService) RegisterUdpUsersBatch(ctx context.Context, req *pb.RegisterUdpUsersBatchRequest) (*pb.RegisterUdpUsersBatchResponse, error) {
+	if s.udp == nil {
+		return &pb.RegisterUdpUsersBatchResponse{Success: false, Error: "udp listener disabled"}, nil
+	}
+	u := s.udp
+	var registered, rejected int32
+	for _, entry := range req.Users {
+		if entry.UserId == "" {
+			rejected++
+			continue
+		}
+		u.mu.Lock()
+		_, exists := u.users[entry.UserIdHash]
+		full := !exists && s.config.UDPMaxUsers > 0 && len(u.users) >= s.config.UDPMaxUsers
+		u.mu.Unlock()
+		if full && !u.evictIdleUser() {
+			rejected++
+			continue
+		}
+		u.mu.Lock()
+		u.users[entry.UserIdHash] = entry.UserId
+		delete(u.lastSeq, entry.UserIdHash)
+		delete(u.g722, entry.UserIdHash)
+		u.mu.Unlock()
+		registered++
+	}
+	u.persist()
+	log.Printf("batch registered %d udp users (%d rejected)", registered, rejected)
+	return &pb.RegisterUdpUsersBatchResponse{
+		Success:    true,
+		Registered: registered,
+		Rejected:   rejected,
+	}, nil
+}
+
+// UnregisterUdpUsersBatch removes many userIdHash mappings in one RPC.
+func (s *LiveKitBridgeService) UnregisterUdpUsersBatch(ctx context.Context, req *pb.UnregisterUdpUsersBatchRequest) (*pb.UnregisterUdpUsersBatchResponse, error) {
+	if s.udp == nil {
+		return &pb.UnregisterUdpUsersBatchResponse{Success: false, Error: "udp listener disabled"}, nil
+	}
+	u := s.udp
+	var unregistered int32
+	u.mu.Lock()
+	for _, hash := range req.UserIdHashes {
+		if _, ok := u.users[hash]; ok {
+			delete(u.users, hash)
+			delete(u.lastSeen, hash)
+			delete(u.pathLost, hash)
+			delete(u.lastSeq, hash)
+			delete(u.g722, hash)
+			unregistered++
+		}
+	}
+	u.mu.Unlock()
+	u.persist()
+	log.Printf("batch unregistered %d udp users", unregistered)
+	return &pb.UnregisterUdpUsersBatchResponse{Success: true, Unregistered: unregistered}, nil
+}
+
+// SubscribeUdpPings streams ping arrivals so the cloud can ack them to the
+// phone over the glasses WebSocket.
+func (s *LiveKitBridgeService) SubscribeUdpPings(req *pb.SubscribeUdpPingsRequest, stream pb.LiveKitBridge_SubscribeUdpPingsServer) error {
+	if s.udp == nil {
+		return status.Errorf(codes.FailedPrecondition, "udp listener disabled")
+	}
+	u := s.udp
+	u.pingMu.Lock()
+	u.pingNextID++
+	id := u.pingNextID
+	sub := &udpPingSub{userID: req.UserId, ch: make(chan *pb.UdpPingEvent, 32)}
+	u.pingSubs[id] = sub
+	u.pingMu.Unlock()
+	defer func() {
+		u.pingMu.Lock()
+		delete(u.pingSubs, id)
+		u.pingMu.Unlock()
+	}()
+
+	for {
+		select {
+		case ev := <-sub.ch:
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// GetUdpStats reports listener state and packet counters.
+func (s *LiveKitBridgeService) GetUdpStats(ctx context.Context, req *pb.GetUdpStatsRequest) (*pb.GetUdpStatsResponse, error) {
+	if s.udp == nil {
+		return &pb.GetUdpStatsResponse{Listening: false}, nil
+	}
+	u := s.udp
+	u.mu.Lock()
+	registered := len(u.users)
+	u.mu.Unlock()
+	resp := &pb.GetUdpStatsResponse{
+		Listening:       u.listening.Load(),
+		Port:            int32(u.port),
+		RegisteredUsers: int32(registered),
+		PacketsReceived: u.packetsReceived.Load(),
+		PacketsDropped:  u.packetsDropped.Load(),
+		PacketsDeduped:  u.packetsDeduped.Load(),
+		PingsReceived:   u.pingsReceived.Load(),
+		BytesReceived:   u.bytesReceived.Load(),
+		Restarts:        u.restarts.Load(),
+		Evictions:       u.evictions.Load(),
+	}
+	if lastErr, ok := u.lastError.Load().(string); ok {
+		resp.LastError = lastErr
+	}
+	return resp, nil
+}
+
+// RebindUdp forces the listener to close and rebind its socket, optionally
+// on a new port (recovering from interface changes without a restart).
+func (s *LiveKitBridgeService) RebindUdp(ctx context.Context, req *pb.RebindUdpRequest) (*pb.RebindUdpResponse, error) {
+	if s.udp == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "udp listener disabled")
+	}
+	u := s.udp
+	if req.Port > 0 {
+		u.mu.Lock()
+		u.port = int(req.Port)
+		u.mu.Unlock()
+	}
+	if err := u.rebind(); err != nil {
+		return &pb.RebindUdpResponse{Success: false, Error: err.Error()}, nil
+	}
+	log.Printf("udp listener rebound by admin on :%d", u.port)
+	return &pb.RebindUdpResponse{Success: true, Port: int32(u.port)}, nil
+}
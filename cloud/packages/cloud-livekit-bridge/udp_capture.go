@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/mentra/livekit-bridge/proto"
+)
+
+// Capture bounds when the request leaves them zero.
+const (
+	captureDefaultDuration = 60 * time.Second
+	captureDefaultMaxBytes = 10 << 20 // 10MB
+	captureSnapLen         = 65535
+)
+
+// udpCapture writes raw UDP payloads for one userIdHash to a pcap file
+// (LINKTYPE_USER0: records hold the datagram as received, no IP headers).
+// One capture at a time per listener; bounded by duration and size so a
+// forgotten capture can't fill the disk.
+type udpCapture struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	hash     uint32
+	maxBytes int64
+	written  int64
+	packets  int64
+	timer    *time.Timer
+	closed   bool
+}
+
+// newUdpCapture creates the pcap file and writes the global header.
+func newUdpCapture(dir string, hash uint32, maxBytes int64) (*udpCapture, error) {
+	path := filepath.Join(dir, fmt.Sprintf("udp-capture-%d-%d.pcap", hash, time.Now().Unix()))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create capture file: %w", err)
+	}
+	// pcap global header: magic, v2.4, UTC, snaplen, LINKTYPE_USER0 (147).
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], captureSnapLen)
+	binary.LittleEndian.PutUint32(header[20:24], 147)
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("write pcap header: %w", err)
+	}
+	return &udpCapture{file: file, path: path, hash: hash, maxBytes: maxBytes}, nil
+}
+
+// record appends one packet; returns false once the capture hit its size
+// bound (or was closed) so the caller can finalize it.
+func (c *udpCapture) record(packet []byte, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))
+	if _, err := c.file.Write(record); err != nil {
+		return false
+	}
+	if _, err := c.file.Write(packet); err != nil {
+		return false
+	}
+	c.packets++
+	c.written += int64(len(packet))
+	return c.written < c.maxBytes
+}
+
+// close finalizes the file; safe to call more than once.
+func (c *udpCapture) close() (path string, packets, written int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.file.Close()
+	}
+	return c.path, c.packets, c.written
+}
+
+// maybeCapture records the packet if an active capture targets hash.
+// Captures see packets before registration/dedup filtering on purpose:
+// the point is to observe exactly what arrived on the wire.
+func (u *UdpAudioListener) maybeCapture(hash uint32, packet []byte) {
+	u.captureMu.Lock()
+	capture := u.capture
+	u.captureMu.Unlock()
+	if capture == nil || capture.hash != hash {
+		return
+	}
+	if !capture.record(packet, time.Now()) {
+		u.finishCapture(capture, "size limit")
+	}
+}
+
+// finishCapture closes the capture and detaches it from the listener.
+func (u *UdpAudioListener) finishCapture(capture *udpCapture, why string) {
+	u.captureMu.Lock()
+	if u.capture == capture {
+		u.capture = nil
+	}
+	u.captureMu.Unlock()
+	path, packets, written := capture.close()
+	log.Printf("udp capture finished (%s): %s (%d packets, %d bytes)", why, path, packets, written)
+}
+
+// StartUdpCapture begins a bounded pcap capture for one userIdHash.
+func (s *LiveKitBridgeService) StartUdpCapture(ctx context.Context, req *pb.StartUdpCaptureRequest) (*pb.StartUdpCaptureResponse, error) {
+	if s.udp == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "udp listener disabled")
+	}
+	u := s.udp
+
+	duration := captureDefaultDuration
+	if req.MaxDurationMs > 0 {
+		duration = time.Duration(req.MaxDurationMs) * time.Millisecond
+	}
+	maxBytes := int64(captureDefaultMaxBytes)
+	if req.MaxBytes > 0 {
+		maxBytes = req.MaxBytes
+	}
+
+	u.captureMu.Lock()
+	defer u.captureMu.Unlock()
+	if u.capture != nil {
+		return &pb.StartUdpCaptureResponse{Success: false, Error: "capture already running"}, nil
+	}
+	capture, err := newUdpCapture(s.config.UDPCaptureDir, req.UserIdHash, maxBytes)
+	if err != nil {
+		return &pb.StartUdpCaptureResponse{Success: false, Error: err.Error()}, nil
+	}
+	capture.timer = time.AfterFunc(duration, func() {
+		u.finishCapture(capture, "duration limit")
+	})
+	u.capture = capture
+	log.Printf("udp capture started for hash=%d: %s (max %s / %d bytes)",
+		req.UserIdHash, capture.path, duration, maxBytes)
+	return &pb.StartUdpCaptureResponse{Success: true, FilePath: capture.path}, nil
+}
+
+// StopUdpCapture ends the active capture, if any.
+func (s *LiveKitBridgeService) StopUdpCapture(ctx context.Context, req *pb.StopUdpCaptureRequest) (*pb.StopUdpCaptureResponse, error) {
+	if s.udp == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "udp listener disabled")
+	}
+	u := s.udp
+	u.captureMu.Lock()
+	capture := u.capture
+	u.capture = nil
+	u.captureMu.Unlock()
+	if capture == nil {
+		return &pb.StopUdpCaptureResponse{Success: false, Error: "no capture running"}, nil
+	}
+	path, packets, written := capture.close()
+	log.Printf("udp capture finished (stopped by admin): %s (%d packets, %d bytes)", path, packets, written)
+	return &pb.StopUdpCaptureResponse{
+		Success:         true,
+		FilePath:        path,
+		PacketsCaptured: packets,
+		BytesCaptured:   written,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Registration persistence: with BRIDGE_UDP_STATE_FILE set, the
+// userIdHash → userId map is snapshotted to disk on every change so a
+// restarted bridge accepts audio from already-streaming phones
+// immediately instead of dropping packets until the cloud re-registers
+// everyone. JSON keys are the decimal hash values.
+
+// loadRegistrations restores the registration map from the state file.
+// A missing file is normal (first start); anything else is logged and
+// the bridge starts empty.
+func (u *UdpAudioListener) loadRegistrations(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("load udp registrations from %s: %v", path, err)
+		}
+		return
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("parse udp registrations from %s: %v", path, err)
+		return
+	}
+	u.mu.Lock()
+	for key, userID := range entries {
+		hash, err := strconv.ParseUint(key, 10, 32)
+		if err != nil || userID == "" {
+			continue
+		}
+		u.users[uint32(hash)] = userID
+	}
+	restored := len(u.users)
+	u.mu.Unlock()
+	log.Printf("restored %d udp registrations from %s", restored, path)
+}
+
+// persist snapshots the registration map to the state file (atomic
+// tmp+rename). No-op when persistence is not configured; errors are
+// logged rather than failing the registration RPC.
+func (u *UdpAudioListener) persist() {
+	path := u.service.config.UDPStateFile
+	if path == "" {
+		return
+	}
+	u.mu.Lock()
+	entries := make(map[string]string, len(u.users))
+	for hash, userID := range u.users {
+		entries[strconv.FormatUint(uint64(hash), 10)] = userID
+	}
+	u.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		log.Printf("marshal udp registrations: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("write udp registrations to %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("rename udp registrations to %s: %v", path, err)
+	}
+}